@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"tss-bigcommerce/internal"
+)
+
+const attemptsUsage = "attempts failed [website] | attempts history <website> <order-id> | attempts ignore <website> <order-id> [reason] | attempts unignore <website> <order-id>"
+
+func attemptsCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", attemptsUsage)
+	}
+
+	switch args[0] {
+	case "failed":
+		website := ""
+		if len(args) > 1 {
+			website = args[1]
+		}
+
+		failed, err := internal.FailedOrders(db, website)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WEBSITE\tORDER ID\tOUTCOME\tATTEMPTS\tLAST ATTEMPT\tERROR")
+		for _, f := range failed {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\t%s\n", f.Website, f.OrderID, f.Outcome, f.Attempts, f.AttemptedAt.Format(time.RFC3339), f.Error)
+		}
+		return w.Flush()
+
+	case "history", "ignore", "unignore":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: %s", attemptsUsage)
+		}
+		website := args[1]
+		orderID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid order id %q: %w", args[2], err)
+		}
+
+		switch args[0] {
+		case "history":
+			attempts, err := internal.OrderAttempts(db, website, orderID)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ATTEMPTED AT\tOUTCOME\tERROR")
+			for _, a := range attempts {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", a.AttemptedAt.Format(time.RFC3339), a.Outcome, a.Error)
+			}
+			return w.Flush()
+
+		case "ignore":
+			reason := strings.Join(args[3:], " ")
+			if err := internal.IgnoreOrder(db, website, orderID, reason); err != nil {
+				return err
+			}
+			fmt.Printf("%s order %d will no longer be retried\n", website, orderID)
+			return nil
+
+		case "unignore":
+			if err := internal.UnignoreOrder(db, website, orderID); err != nil {
+				return err
+			}
+			fmt.Printf("%s order %d will be retried on the next run\n", website, orderID)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown attempts command %q", args[0])
+}
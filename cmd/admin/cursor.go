@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"tss-bigcommerce/internal"
+)
+
+const cursorUsage = "cursor list | cursor reset <website> <last-order-id>"
+
+func cursorCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", cursorUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		cursors, err := internal.SyncCursors(db)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WEBSITE\tLAST ORDER ID\tLAST MODIFIED\tUPDATED AT")
+		for _, c := range cursors {
+			lastModified := "-"
+			if !c.LastModified.IsZero() {
+				lastModified = c.LastModified.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", c.Website, c.LastOrderID, lastModified, c.UpdatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+
+	case "reset":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: %s", cursorUsage)
+		}
+		lastOrderID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid order id %q: %w", args[2], err)
+		}
+		if err := internal.ResetSyncCursor(db, args[1], lastOrderID); err != nil {
+			return err
+		}
+		fmt.Printf("%s cursor reset; next run starts at order %d\n", args[1], lastOrderID+1)
+		return nil
+	}
+
+	return fmt.Errorf("unknown cursor command %q", args[0])
+}
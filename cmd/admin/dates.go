@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"tss-bigcommerce/internal"
+)
+
+const datesUsage = "dates list [website] | dates set <website> <order-id> <delivery DD-MM-YYYY> <collection DD-MM-YYYY> [note] | dates delete <website> <order-id>"
+
+func datesCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", datesUsage)
+	}
+
+	switch args[0] {
+	case "list":
+		website := ""
+		if len(args) > 1 {
+			website = args[1]
+		}
+
+		overrides, err := internal.HireDateOverrides(db, website)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WEBSITE\tORDER ID\tDELIVERY\tCOLLECTION\tSET AT\tNOTE")
+		for _, o := range overrides {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", o.Website, o.OrderID, o.DeliveryDate, o.CollectionDate, o.CreatedAt.Format(time.RFC3339), o.Note)
+		}
+		return w.Flush()
+
+	case "set", "delete":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: %s", datesUsage)
+		}
+		website := args[1]
+		orderID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid order id %q: %w", args[2], err)
+		}
+
+		if args[0] == "delete" {
+			if err := internal.DeleteHireDateOverride(db, website, orderID); err != nil {
+				return err
+			}
+			fmt.Printf("removed the hire dates set for %s order %d\n", website, orderID)
+			return nil
+		}
+
+		if len(args) < 5 {
+			return fmt.Errorf("usage: %s", datesUsage)
+		}
+		note := strings.Join(args[5:], " ")
+		if err := internal.SetHireDateOverride(db, website, orderID, args[3], args[4], note); err != nil {
+			return err
+		}
+		fmt.Printf("%s order %d will be exported with delivery %s and collection %s\n", website, orderID, args[3], args[4])
+		return nil
+	}
+
+	return fmt.Errorf("unknown dates command %q", args[0])
+}
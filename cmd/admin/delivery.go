@@ -0,0 +1,47 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"tss-bigcommerce/internal"
+)
+
+const deliveryUsage = "delivery explain <website> <order-id>"
+
+func deliveryCommand(db *sql.DB, args []string) error {
+	if len(args) != 3 || args[0] != "explain" {
+		return fmt.Errorf("usage: %s", deliveryUsage)
+	}
+	orderID, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid order id %q: %w", args[2], err)
+	}
+
+	store, err := loadStore(args[1])
+	if err != nil {
+		return err
+	}
+	decision, err := internal.ExplainDeliveryType(store, orderID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tMATCHED\tDETAIL")
+	for _, check := range decision.Checks {
+		fmt.Fprintf(w, "%s\t%t\t%s\n", check.Rule, check.Matched, check.Detail)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if decision.Rule == "" {
+		fmt.Printf("\nno rule matched, order %d defaults to %s\n", orderID, decision.DeliveryType)
+		return nil
+	}
+	fmt.Printf("\norder %d is %s by rule %s\n", orderID, decision.DeliveryType, decision.Rule)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"tss-bigcommerce/internal"
+)
+
+const importsUsage = "imports pending [website]"
+
+func importsCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 || args[0] != "pending" {
+		return fmt.Errorf("usage: %s", importsUsage)
+	}
+
+	website := ""
+	if len(args) > 1 {
+		website = args[1]
+	}
+
+	pending, err := internal.PendingImports(db, website)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEBSITE\tORDER ID\tWRITTEN AT\tWAITING\tFILE")
+	for _, f := range pending {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", f.Website, f.OrderID, f.CreatedAt.Format(time.RFC3339), time.Since(f.CreatedAt).Round(time.Minute), f.FilePath)
+	}
+	return w.Flush()
+}
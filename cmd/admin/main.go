@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"tss-bigcommerce/internal"
+
+	"github.com/joho/godotenv"
+)
+
+type command struct {
+	usage string
+	run   func(db *sql.DB, args []string) error
+	// skipMigrate opens the database without applying pending migrations.
+	skipMigrate bool
+}
+
+var commands = map[string]command{
+	"attempts":   {usage: attemptsUsage, run: attemptsCommand},
+	"cursor":     {usage: cursorUsage, run: cursorCommand},
+	"dates":      {usage: datesUsage, run: datesCommand},
+	"delivery":   {usage: deliveryUsage, run: deliveryCommand},
+	"imports":    {usage: importsUsage, run: importsCommand},
+	"migrate":    {usage: migrateUsage, run: migrateCommand, skipMigrate: true},
+	"quarantine": {usage: quarantineUsage, run: quarantineCommand},
+}
+
+var configPath = flag.String("config", "config.yaml", "path to the store config file, for commands that export orders")
+
+// loadStore reads one store from the config file, with its API token from the
+// environment or .env.
+func loadStore(website string) (internal.StoreConfig, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("[WARNING] loading .env file: %v", err)
+	}
+	config, err := internal.LoadConfig(*configPath)
+	if err != nil {
+		return internal.StoreConfig{}, err
+	}
+	store, ok := config.StoreByWebsite(website)
+	if !ok {
+		return internal.StoreConfig{}, fmt.Errorf("no enabled store named %s in %s", website, *configPath)
+	}
+	if err := store.CheckToken(); err != nil {
+		return internal.StoreConfig{}, err
+	}
+	return store, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: admin [-db path] [-config path] <command> [args]\n\ncommands:\n")
+	for _, name := range slices.Sorted(maps.Keys(commands)) {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	flag.PrintDefaults()
+}
+
+func run() error {
+	dbPath := flag.String("db", "data/main.db", "path to the sqlite database")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	open := internal.Database
+	if c.skipMigrate {
+		open = internal.OpenDatabase
+	}
+
+	db, err := open(dbPath)
+	if err != nil {
+		return fmt.Errorf("error conneting to the database %w", err)
+	}
+	defer db.Close()
+
+	return c.run(db, flag.Args()[1:])
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("Failed to run command %v", err)
+	}
+}
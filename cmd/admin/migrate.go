@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"tss-bigcommerce/internal"
+)
+
+const migrateUsage = "migrate status | migrate up [n] | migrate down [n]"
+
+func migrateCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: %s", migrateUsage)
+	}
+
+	// up applies everything by default, down only reverts the latest
+	steps := 0
+	if args[0] == "down" {
+		steps = 1
+	}
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations %q", args[1])
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "status":
+		statuses, err := internal.MigrationStatuses(db)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+
+	case "up":
+		done, err := internal.MigrateUp(db, steps)
+		for _, m := range done {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		done, err := internal.MigrateDown(db, steps)
+		for _, m := range done {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		return err
+	}
+
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"tss-bigcommerce/internal"
+)
+
+const quarantineUsage = "quarantine list [website] | quarantine show <website> <order-id> | quarantine edit <website> <order-id> <field>=<value>... | quarantine release <website> <order-id>"
+
+const quarantineEditFields = "delivery_date, collection_date, instructions or delivery_type (delivery or collection)"
+
+func quarantineCommand(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", quarantineUsage)
+	}
+
+	if args[0] == "list" {
+		website := ""
+		if len(args) > 1 {
+			website = args[1]
+		}
+
+		quarantined, err := internal.QuarantinedOrders(db, website)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WEBSITE\tORDER ID\tQUARANTINED AT\tREASON")
+		for _, q := range quarantined {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", q.Website, q.OrderID, q.QuarantinedAt.Format(time.RFC3339), q.Reason)
+		}
+		return w.Flush()
+	}
+
+	if len(args) < 3 {
+		return fmt.Errorf("usage: %s", quarantineUsage)
+	}
+	website := args[1]
+	orderID, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid order id %q: %w", args[2], err)
+	}
+
+	switch args[0] {
+	case "show":
+		q, ok, err := internal.GetQuarantinedOrder(db, website, orderID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s order %d is not in quarantine", website, orderID)
+		}
+		return printQuarantinedOrder(q)
+
+	case "edit":
+		if len(args) < 4 {
+			return fmt.Errorf("usage: %s", quarantineUsage)
+		}
+		edits, err := parseQuarantineEdits(args[3:])
+		if err != nil {
+			return err
+		}
+		if err := internal.EditQuarantinedOrder(db, website, orderID, edits); err != nil {
+			return err
+		}
+		fmt.Printf("updated %s order %d, release it to write the file\n", website, orderID)
+		return nil
+
+	case "release":
+		store, err := loadStore(website)
+		if err != nil {
+			return err
+		}
+		if err := internal.ReleaseOrder(db, store, orderID); err != nil {
+			return err
+		}
+		fmt.Printf("released %s order %d\n", website, orderID)
+		return nil
+	}
+
+	return fmt.Errorf("unknown quarantine command %q", args[0])
+}
+
+func parseQuarantineEdits(args []string) (internal.QuarantineEdits, error) {
+	var edits internal.QuarantineEdits
+	for _, arg := range args {
+		field, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return edits, fmt.Errorf("expected <field>=<value>, got %q", arg)
+		}
+
+		switch field {
+		case "delivery_date":
+			edits.DeliveryDate = &value
+		case "collection_date":
+			edits.CollectionDate = &value
+		case "instructions":
+			edits.DeliveryInstructions = &value
+		case "delivery_type":
+			t, err := internal.ParseDelivery(value)
+			if err != nil {
+				return edits, err
+			}
+			edits.DeliveryType = &t
+		default:
+			return edits, fmt.Errorf("unknown field %q, expected %s", field, quarantineEditFields)
+		}
+	}
+	return edits, nil
+}
+
+func printQuarantinedOrder(q internal.QuarantinedOrder) error {
+	fmt.Printf("%s order %d, quarantined %s\n", q.Website, q.OrderID, q.QuarantinedAt.Format(time.RFC3339))
+	if q.ReleasedAt != nil {
+		fmt.Printf("released %s\n", q.ReleasedAt.Format(time.RFC3339))
+	}
+	fmt.Printf("reason: %s\n", q.Reason)
+	for _, warning := range q.Warnings {
+		fmt.Printf("warning: %s\n", warning)
+	}
+
+	fmt.Printf("\nedits:\n")
+	if q.Edits.DeliveryDate != nil {
+		fmt.Printf("  delivery_date=%s\n", *q.Edits.DeliveryDate)
+	}
+	if q.Edits.CollectionDate != nil {
+		fmt.Printf("  collection_date=%s\n", *q.Edits.CollectionDate)
+	}
+	if q.Edits.DeliveryInstructions != nil {
+		fmt.Printf("  instructions=%s\n", *q.Edits.DeliveryInstructions)
+	}
+	if q.Edits.DeliveryType != nil {
+		fmt.Printf("  delivery_type=%s\n", *q.Edits.DeliveryType)
+	}
+
+	fmt.Printf("\ncustomer message:\n%s\n\n", q.Data.Order.CustomerMessage)
+
+	b, err := json.MarshalIndent(q.Data, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("order data:\n%s\n", b)
+	return nil
+}
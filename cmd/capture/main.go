@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"tss-bigcommerce/internal"
+
+	"github.com/joho/godotenv"
+)
+
+// capture fetches orders from a store and writes their anonymised customer
+// messages into the corpus that TestParseCustomerMessageCorpus reads. The
+// expected values are whatever the parser currently produces, so check each
+// sample by hand before committing it.
+func run() error {
+	configPath := flag.String("config", "config.yaml", "path to the store config file")
+	website := flag.String("store", "", "website name of the store to capture from")
+	orders := flag.String("order", "", "orders to capture, e.g. 4200 or 4200-4210")
+	out := flag.String("out", filepath.Join("internal", "testdata", "customer_messages"), "corpus directory to write samples to")
+	flag.Parse()
+
+	if *website == "" || *orders == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("[ERROR] loading .env file: %v", err)
+	}
+
+	config, err := internal.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("[ERROR] loading config: %w", err)
+	}
+
+	store, ok := config.StoreByWebsite(*website)
+	if !ok {
+		return fmt.Errorf("[ERROR] no enabled store named %s in config", *website)
+	}
+	if err := store.CheckToken(); err != nil {
+		return fmt.Errorf("[ERROR] loading config: %w", err)
+	}
+
+	orderIDs, err := internal.ParseOrderIDs(*orders)
+	if err != nil {
+		return fmt.Errorf("[ERROR] %w", err)
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+
+	source := internal.NewOrderSource(store)
+	for _, orderID := range orderIDs {
+		order, err := source.GetOrder(orderID)
+		if err != nil {
+			log.Printf("[ERROR] getting order %d: %v", orderID, err)
+			continue
+		}
+		if order.CustomerMessage == "" {
+			log.Printf("skipping order %d, it has no customer message", orderID)
+			continue
+		}
+
+		shippingAddresses, err := source.GetOrderShippingAddresses(orderID)
+		if err != nil {
+			log.Printf("[ERROR] getting shipping addresses for order %d: %v", orderID, err)
+			continue
+		}
+
+		sample := internal.CaptureSample(store.Website, order, shippingAddresses)
+		b, err := json.MarshalIndent(sample, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fileName := filepath.Join(*out, fmt.Sprintf("%s_%d.json", store.Website, order.ID))
+		if err := os.WriteFile(fileName, append(b, '\n'), 0644); err != nil {
+			return err
+		}
+		log.Printf("wrote %s", fileName)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatalf("Failed to capture samples %v", err)
+	}
+}
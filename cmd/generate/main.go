@@ -1,75 +1,70 @@
 package main
 
 import (
-	"database/sql"
+	"flag"
 	"fmt"
 	"log"
-	"os"
 	"tss-bigcommerce/internal"
 
 	"github.com/joho/godotenv"
 )
 
 func run() error {
+	configPath := flag.String("config", "config.yaml", "path to the store config file")
+	force := flag.Bool("force", false, "regenerate orders that already have a file, keeping the previous version in order_file_history")
+	dryRun := flag.Bool("dry-run", false, "print the file for each order, and a diff against any existing file, without writing files or updating the database")
+	orders := flag.String("order", "", "only process these orders, e.g. 4200 or 4200-4210")
+	website := flag.String("store", "", "only process the store with this website name")
+	flag.Parse()
+
 	if err := godotenv.Load(); err != nil {
 		return fmt.Errorf("[ERROR] loading .env file: %v", err)
 	}
 
-	fileDestination := os.Getenv("FILE_PATH")
-	if fileDestination == "" {
-		return fmt.Errorf("file destination cannot be empty")
-	}
-
-	db, err := internal.Database(nil)
-	if err != nil {
-		return fmt.Errorf("error conneting to the database %w", err)
-	}
-	defer db.Close()
-
-	stmt, err := db.Prepare(`SELECT order_id FROM orders WHERE website = ? LIMIT 1`)
+	config, err := internal.LoadConfig(*configPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("[ERROR] loading config: %w", err)
 	}
-	defer stmt.Close()
 
-	//TODO retrieve last recorded order id from both stores and add to the config
-
-	caterHireConfig := internal.GenerateFilesConfig{}
-	if err := stmt.QueryRow(internal.CATERHIRE).Scan(&caterHireConfig.MinOrderID); err != nil {
-		if err == sql.ErrNoRows {
-			caterHireConfig.MinOrderID = 4126
-		} else {
-			return err
+	if *website != "" {
+		store, ok := config.StoreByWebsite(*website)
+		if !ok {
+			return fmt.Errorf("[ERROR] no enabled store named %s in config", *website)
 		}
+		config.Stores = []internal.StoreConfig{store}
 	}
-	fmt.Println("caterHireConfig.MinOrderID", caterHireConfig.MinOrderID)
-	caterHireConfig.JobType = internal.CaterHireJobType
-	caterHireConfig.StoreHash = os.Getenv("CH_STORE_HASH")
-	caterHireConfig.AuthToken = os.Getenv("CH_XAUTHTOKEN")
-	if caterHireConfig.StoreHash == "" || caterHireConfig.AuthToken == "" {
-		return fmt.Errorf("[ERROR] missing environment variables CH_STORE_HASH or CH_XAUTHTOKEN")
+	if err := config.CheckTokens(); err != nil {
+		return fmt.Errorf("[ERROR] loading config: %w", err)
 	}
-	if err := internal.GenerateFiles(db, fileDestination, caterHireConfig); err != nil {
-		return fmt.Errorf("failed to run GenerateFiles for caterhire")
+
+	if _, err := internal.CheckStatuses(config); err != nil {
+		return fmt.Errorf("[ERROR] checking order statuses: %w", err)
 	}
 
-	// TODO remove
-	if true {
-		return nil
+	opts := internal.GenerateOptions{Force: *force, DryRun: *dryRun}
+	if *orders != "" {
+		if len(config.Stores) > 1 {
+			return fmt.Errorf("[ERROR] --order needs --store when more than one store is configured")
+		}
+		opts.OrderIDs, err = internal.ParseOrderIDs(*orders)
+		if err != nil {
+			return fmt.Errorf("[ERROR] %w", err)
+		}
 	}
 
-	hireAllConfig := internal.GenerateFilesConfig{}
-	if err := stmt.QueryRow(internal.HIREALL).Scan(&hireAllConfig.MinOrderID); err != nil {
-		return err
+	// a dry run must not write to the database, so it is opened read-only
+	open := internal.Database
+	if *dryRun {
+		open = internal.ReadOnlyDatabase
 	}
-	hireAllConfig.JobType = internal.HireAlljobType
-	hireAllConfig.StoreHash = os.Getenv("HA_STORE_HASH")
-	hireAllConfig.AuthToken = os.Getenv("HA_XAUTHTOKEN")
-	if hireAllConfig.StoreHash == "" || hireAllConfig.AuthToken == "" {
-		return fmt.Errorf("[ERROR] missing environment variables HA_STORE_HASH or HA_XAUTHTOKEN")
+	db, err := open(nil)
+	if err != nil {
+		return fmt.Errorf("error conneting to the database %w", err)
 	}
-	if err := internal.GenerateFiles(db, fileDestination, hireAllConfig); err != nil {
-		return fmt.Errorf("failed to run GenerateFiles for hireall")
+	defer db.Close()
+
+	if err := internal.GenerateFiles(db, config, opts); err != nil {
+		return fmt.Errorf("failed to run GenerateFiles: %w", err)
 	}
 	return nil
 }
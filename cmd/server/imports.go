@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"tss-bigcommerce/internal"
+
+	"go.uber.org/zap"
+)
+
+// watchImports checks every store's output directory each interval for files
+// the importer has taken, and alerts on Telegram about files that were
+// rejected or are still waiting past the store's SLA.
+func watchImports(logger *zap.Logger, db *sql.DB, config internal.Config, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		for _, store := range config.Stores {
+			if err := checkImports(logger, db, store, now); err != nil {
+				logger.Error("Import check failed", zap.String("website", store.Website), zap.Error(err))
+			}
+		}
+	}
+}
+
+func checkImports(logger *zap.Logger, db *sql.DB, store internal.StoreConfig, now time.Time) error {
+	check, err := internal.CheckImports(db, store, now)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range check.Consumed {
+		logger.Info("Order file imported",
+			zap.String("website", f.Website),
+			zap.Int("order_id", f.OrderID),
+			zap.String("consumed_via", string(f.ConsumedVia)),
+		)
+	}
+
+	var lines []string
+	var orderIDs []int
+	for _, f := range check.Rejected {
+		lines = append(lines, fmt.Sprintf("order %d was rejected into %s", f.OrderID, store.ErrorDir))
+		orderIDs = append(orderIDs, f.OrderID)
+	}
+	for _, f := range check.Overdue {
+		lines = append(lines, fmt.Sprintf("order %d has not been imported after %s (%s)", f.OrderID, now.Sub(f.CreatedAt).Round(time.Minute), f.FilePath))
+		orderIDs = append(orderIDs, f.OrderID)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Import problems for %s:\n%s", store.Website, strings.Join(lines, "\n"))
+	logger.Warn("Import problems", zap.String("website", store.Website), zap.Ints("order_ids", orderIDs))
+	if err := sendTelegramNotification(message); err != nil {
+		// try again on the next check
+		return fmt.Errorf("failed to send import alert: %w", err)
+	}
+	return internal.MarkImportAlerted(db, store.Website, orderIDs...)
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
+	"tss-bigcommerce/internal"
 
+	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -182,10 +185,51 @@ func setupLogger() *zap.Logger {
 }
 
 func main() {
+	configPath := flag.String("config", "config.yaml", "path to the store config file")
+	importCheckInterval := flag.Duration("import-check-interval", time.Minute, "how often to check whether exported files have been imported, 0 to disable")
+	flag.Parse()
+
 	// Initialize logger
 	logger := setupLogger()
 	defer logger.Sync() // Flush logs on exit
 
+	if err := godotenv.Load(); err != nil {
+		logger.Warn("Could not load .env file", zap.Error(err))
+	}
+
+	webhookSecret := os.Getenv("WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		logger.Error("WEBHOOK_SECRET env var is empty")
+		os.Exit(1)
+	}
+
+	config, err := internal.LoadConfig(*configPath)
+	if err == nil {
+		err = config.CheckTokens()
+	}
+	if err != nil {
+		logger.Error("Failed to load config", zap.Error(err))
+		os.Exit(1)
+	}
+
+	// resolved once here rather than for every webhook
+	config, err = internal.CheckStatuses(config)
+	if err != nil {
+		logger.Error("Store has an unknown order status", zap.Error(err))
+		os.Exit(1)
+	}
+
+	db, err := internal.Database(nil)
+	if err != nil {
+		logger.Error("Failed to connect to the database", zap.Error(err))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if *importCheckInterval > 0 {
+		go watchImports(logger, db, config, *importCheckInterval)
+	}
+
 	// Create handler with logging middleware
 	handler := Handler{
 		h:      loggingMiddleware(logger, helloHandler),
@@ -193,10 +237,14 @@ func main() {
 	}
 
 	http.Handle("/", handler)
+	http.Handle("/webhooks/bigcommerce", Handler{
+		h:      loggingMiddleware(logger, webhookHandler(logger, db, webhookSecret, config)),
+		logger: logger,
+	})
 
 	port := ":8080"
 	logger.Info("Server starting", zap.String("port", port))
-	err := http.ListenAndServe(port, nil)
+	err = http.ListenAndServe(port, nil)
 	if err != nil {
 		logger.Error("Server failed to start", zap.Error(err))
 		os.Exit(1) // Explicitly exit after logging, allowing defer to run
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"tss-bigcommerce/internal"
+
+	"go.uber.org/zap"
+)
+
+const webhookSecretHeader = "X-Webhook-Secret"
+
+// webhookPayload is the body BigCommerce posts for store/order/* events.
+type webhookPayload struct {
+	Scope    string `json:"scope"`
+	StoreID  string `json:"store_id"`
+	Producer string `json:"producer"`
+	Hash     string `json:"hash"`
+	Data     struct {
+		Type string `json:"type"`
+		ID   int    `json:"id"`
+	} `json:"data"`
+}
+
+// storeHash returns the hash from a producer of the form "stores/{store_hash}".
+func (p webhookPayload) storeHash() string {
+	return strings.TrimPrefix(p.Producer, "stores/")
+}
+
+// webhookHandler exports orders as soon as BigCommerce tells us about them.
+// Orders that already have a file are checked for changes instead. Orders that
+// are not in one of the store's export statuses, or that have not changed, are
+// acknowledged and ignored so BigCommerce does not retry them.
+func webhookHandler(logger *zap.Logger, db *sql.DB, secret string, config internal.Config) HandlerFunc {
+	// created, updated and statusUpdated usually arrive together for the
+	// same order
+	var mu sync.Mutex
+
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return nil
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(webhookSecretHeader)), []byte(secret)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return nil
+		}
+
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return nil
+		}
+
+		switch payload.Scope {
+		case "store/order/created", "store/order/updated", "store/order/statusUpdated":
+		default:
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		store, ok := config.StoreByHash(payload.storeHash())
+		if !ok {
+			http.Error(w, "unknown store", http.StatusForbidden)
+			return nil
+		}
+
+		if payload.Data.ID == 0 {
+			http.Error(w, "missing order id", http.StatusBadRequest)
+			return nil
+		}
+
+		fields := []zap.Field{
+			zap.String("scope", payload.Scope),
+			zap.String("website", store.Website),
+			zap.Int("order_id", payload.Data.ID),
+		}
+
+		mu.Lock()
+		err := internal.GenerateFile(db, store, payload.Data.ID)
+		var action internal.Action
+		if errors.Is(err, internal.ErrAlreadyExported) {
+			action, err = internal.SyncOrderChange(db, store, payload.Data.ID)
+			if err == nil && action == internal.ActionNone {
+				err = internal.ErrAlreadyExported
+			}
+		}
+		mu.Unlock()
+
+		if errors.Is(err, internal.ErrOrderNotReady) || errors.Is(err, internal.ErrAlreadyExported) || errors.Is(err, internal.ErrQuarantined) {
+			logger.Info("Webhook ignored", append(fields, zap.String("reason", err.Error()))...)
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export order %d: %w", payload.Data.ID, err)
+		}
+
+		if action != internal.ActionNone {
+			logger.Info("Order change exported from webhook", append(fields, zap.String("action", string(action)))...)
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+
+		logger.Info("Order exported from webhook", fields...)
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
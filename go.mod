@@ -3,14 +3,19 @@ module tss-bigcommerce
 go 1.23.1
 
 require (
+	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/joho/godotenv v1.5.1
 	github.com/mattn/go-sqlite3 v1.14.24
+	github.com/pkg/sftp v1.13.9
 	github.com/seanomeara96/go-bigcommerce v0.0.0-20241204094450-d4d540e9e014
+	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 )
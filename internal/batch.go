@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// BatchConfig writes the orders from a run to shared files rather than a file
+// per order. Orders exported from the webhook, with --order or by releasing
+// them from quarantine still get a file each.
+type BatchConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxOrders starts a new file after this many orders, 0 for one file per
+	// run.
+	MaxOrders int `yaml:"max_orders"`
+}
+
+const batchTimeLayout = "20060102T150405Z"
+
+type batchedOrder struct {
+	bundle        OrderBundle
+	order         bigcommerce.Order
+	hireJob       Order
+	replace       bool
+	advanceCursor bool
+}
+
+// orderBatch collects the orders converted during one run for a store and
+// writes them to batch files. Nothing about a batched order is recorded until
+// its file has been written, so orders in a batch that is never written are
+// fetched again on the next run.
+type orderBatch struct {
+	db        *sql.DB
+	source    OrderSource
+	store     StoreConfig
+	startedAt time.Time
+	files     int
+	pending   []batchedOrder
+	// skipped are orders to move the sync cursor past once the pending
+	// orders before them have been written.
+	skipped []bigcommerce.Order
+}
+
+func newOrderBatch(db *sql.DB, source OrderSource, store StoreConfig) *orderBatch {
+	return &orderBatch{db: db, source: source, store: store, startedAt: time.Now().UTC()}
+}
+
+// add converts an order and queues it for the next batch file, journaling the
+// attempt if it cannot be converted. advanceCursor moves the sync cursor past
+// the order once it has been written. The batch is flushed by the caller once
+// it is full.
+func (b *orderBatch) add(order bigcommerce.Order, replace, advanceCursor bool) error {
+	bundle, hireJob, err := prepareOrder(b.db, b.source, b.store, order)
+	if err == nil {
+		// checked on its own so one bad order cannot hold up the batch
+		if _, verr := newEncoder(b.store.Format).Encode(Orders{Orders: []Order{hireJob}}); verr != nil {
+			err = attemptError(OutcomeValidationFailed, "order %d: %v", order.ID, verr)
+		}
+	}
+	if err != nil {
+		return recordOutcome(b.db, b.store.Website, order.ID, err)
+	}
+
+	b.pending = append(b.pending, batchedOrder{bundle: bundle, order: order, hireJob: hireJob, replace: replace, advanceCursor: advanceCursor})
+	return nil
+}
+
+// full reports whether the next batch file has as many orders as it can take.
+func (b *orderBatch) full() bool {
+	return b.store.Batch.MaxOrders > 0 && len(b.pending) >= b.store.Batch.MaxOrders
+}
+
+// skip moves the sync cursor past an order that is not being exported, once
+// any orders queued before it have been written.
+func (b *orderBatch) skip(order bigcommerce.Order) error {
+	if len(b.pending) > 0 {
+		b.skipped = append(b.skipped, order)
+		return nil
+	}
+	return AdvanceSyncCursor(b.db, b.store.Website, order.ID)
+}
+
+// name is the next batch file's name, without its extension, for the store
+// and when the run started.
+func (b *orderBatch) name() string {
+	return fmt.Sprintf("orders-%s-%s-%03d", b.store.Website, b.startedAt.Format(batchTimeLayout), b.files)
+}
+
+// flush writes the queued orders to a new batch file and records each of them
+// as exported.
+func (b *orderBatch) flush() error {
+	pending, skipped := b.pending, b.skipped
+	b.pending, b.skipped = nil, nil
+	if len(pending) == 0 {
+		return nil
+	}
+
+	b.files++
+	name := b.name()
+	hireJobs := make([]Order, len(pending))
+	orderIDs := make([]int, len(pending))
+	for i, p := range pending {
+		hireJobs[i], orderIDs[i] = p.hireJob, p.order.ID
+	}
+
+	sink := newSink(b.store)
+	fileName, err := sendOrders(b.store, sink, name, hireJobs, orderIDs)
+	if err != nil {
+		var attemptErr *AttemptError
+		if !errors.As(err, &attemptErr) {
+			err = attemptError(OutcomeWriteFailed, "writing batch file %s: %v", name, err)
+		}
+		// a refused batch would be refused again, so each order in it is
+		// held for review and can be released on its own
+		rejected := refused(err)
+		for _, p := range pending {
+			perr := err
+			if rejected {
+				perr = holdForReview(b.db, b.store.Website, p.bundle, err)
+			}
+			if rerr := RecordAttempt(b.db, b.store.Website, p.order.ID, perr); rerr != nil {
+				return errors.Join(err, rerr)
+			}
+		}
+		return err
+	}
+	log.Printf("wrote %d %s orders to %s", len(pending), b.store.Website, fileName)
+
+	exportedAt := time.Now()
+	for _, p := range pending {
+		if err := b.record(p, fileName, sink.Watched()); err != nil {
+			return err
+		}
+		if err := writeBack(b.source, b.store, p.order, fileName, exportedAt); err != nil {
+			log.Printf("[ERROR] order %d was exported but could not be updated in BigCommerce: %v", p.order.ID, err)
+		}
+	}
+	for _, order := range skipped {
+		if err := AdvanceSyncCursor(b.db, b.store.Website, order.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record saves a batched order's file in the orders table and journals the
+// export. watched is false if the sink left nothing for the importer to pick
+// up.
+func (b *orderBatch) record(p batchedOrder, fileName string, watched bool) error {
+	website, orderID := b.store.Website, p.order.ID
+
+	var err error
+	if p.replace {
+		var previous []byte
+		if watched {
+			if previous, err = previousFile(b.db, website, orderID); err != nil {
+				return err
+			}
+		}
+		err = ReplaceFileCreation(b.db, orderID, website, fileName, previous)
+	} else {
+		err = SaveFileCreation(b.db, orderID, website, fileName)
+	}
+	if errors.Is(err, ErrAlreadyExported) {
+		log.Printf("[WARNING] order %d was exported by another process during this run", orderID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	hash, err := hireJobHash(p.hireJob)
+	if err != nil {
+		return err
+	}
+	if err := setContentHash(b.db, website, orderID, hash); err != nil {
+		return err
+	}
+	if !watched {
+		if err := markSent(b.db, website, orderID); err != nil {
+			return err
+		}
+	}
+	if err := RecordAttempt(b.db, website, orderID, nil); err != nil {
+		return err
+	}
+	if !p.advanceCursor {
+		return nil
+	}
+	return AdvanceSyncCursor(b.db, website, orderID)
+}
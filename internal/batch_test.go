@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBatchFiles(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.Batch = BatchConfig{Enabled: true}
+	store.Handoff = HandoffReady
+	config := Config{Stores: []StoreConfig{store}}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(store.OutputDir, "*.xml"))
+	if len(files) != 1 || !strings.HasPrefix(filepath.Base(files[0]), "orders-caterhire-") || !strings.HasSuffix(files[0], "-001.xml") {
+		t.Fatalf("expected a single batch file, got %v", files)
+	}
+	batchFile := files[0]
+
+	b, err := os.ReadFile(batchFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "<Order>"); n != 2 {
+		t.Errorf("expected 2 orders in the batch file, got %d", n)
+	}
+
+	var manifest fileManifest
+	b, err = os.ReadFile(batchFile + ".manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.File != filepath.Base(batchFile) || !slices.Equal(manifest.OrderIDs, []int{4200, 4201}) {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+	if _, err := os.Stat(batchFile + ".ready"); err != nil {
+		t.Errorf("expected a ready file: %v", err)
+	}
+
+	pending, err := PendingImports(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].FilePath != batchFile || pending[1].FilePath != batchFile {
+		t.Errorf("expected both orders recorded against the batch file, got %+v", pending)
+	}
+	cursor, _, err := GetSyncCursor(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.LastOrderID != 4201 {
+		t.Errorf("expected the cursor at 4201, got %d", cursor.LastOrderID)
+	}
+
+	// nothing new, so no new file
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(store.OutputDir, "*.xml")); len(files) != 1 {
+		t.Errorf("expected no second batch file, got %v", files)
+	}
+}
+
+func TestBatchMaxOrders(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.Batch = BatchConfig{Enabled: true, MaxOrders: 1}
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(store.OutputDir, "orders-caterhire-*.xml"))
+	if len(files) != 2 || !strings.HasSuffix(files[0], "-001.xml") || !strings.HasSuffix(files[1], "-002.xml") {
+		t.Fatalf("expected two batch files, got %v", files)
+	}
+	for i, orderID := range []int{4200, 4201} {
+		b, err := os.ReadFile(files[i] + ".manifest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var manifest fileManifest
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(manifest.OrderIDs, []int{orderID}) {
+			t.Errorf("expected %s to hold order %d, got %v", files[i], orderID, manifest.OrderIDs)
+		}
+	}
+}
+
+func TestBatchFailureCountsEveryOrder(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	server := newImportServer(t)
+	server.status = http.StatusServiceUnavailable
+	db := testDatabase(t)
+	store := testStore("")
+	store.Sink = SinkConfig{Type: SinkHTTP, URL: server.URL, Timeout: defaultSinkTimeout}
+	store.Batch = BatchConfig{Enabled: true, MaxOrders: 2}
+
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// 4200 and 4201 were in the batch that could not be sent, and 4202 has
+	// an unparseable date
+	if !strings.Contains(out.String(), "converted 0, skipped 0, failed 3") {
+		t.Errorf("expected both orders in the failed batch to be counted, got\n%s", out.String())
+	}
+}
@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// Action marks an order file as something other than a new job.
+type Action string
+
+const (
+	ActionNone   Action = ""
+	ActionAmend  Action = "Amend"
+	ActionCancel Action = "Cancel"
+)
+
+var defaultCancelStatusNames = []string{"Cancelled", "Refunded", "Declined"}
+
+// contentHash identifies what was sent for an order, so a later change to it
+// can be detected.
+func contentHash(xml []byte) string {
+	sum := sha256.Sum256(xml)
+	return hex.EncodeToString(sum[:])
+}
+
+// exportedOrder is the orders table row for an exported order.
+type exportedOrder struct {
+	ContentHash string
+	Revision    int
+	FilePath    string
+	Cancelled   bool
+}
+
+func getExportedOrder(db *sql.DB, website string, orderID int) (exportedOrder, bool, error) {
+	var o exportedOrder
+	err := db.QueryRow(`SELECT content_hash, revision, file_path, cancelled_at IS NOT NULL FROM orders WHERE website = ? AND order_id = ?`, website, orderID).
+		Scan(&o.ContentHash, &o.Revision, &o.FilePath, &o.Cancelled)
+	if err == sql.ErrNoRows {
+		return exportedOrder{}, false, nil
+	}
+	if err != nil {
+		return exportedOrder{}, false, err
+	}
+	return o, true, nil
+}
+
+func setContentHash(db *sql.DB, website string, orderID int, hash string) error {
+	_, err := db.Exec(`UPDATE orders SET content_hash = ? WHERE website = ? AND order_id = ?`, hash, website, orderID)
+	return err
+}
+
+// changeDocumentName is the file name, without its extension, an amendment or
+// cancellation is sent as, so it does not overwrite the original if the
+// importer has not taken it yet.
+func changeDocumentName(orderID int, action Action, revision int) string {
+	name := orderDocumentName(orderID)
+	switch action {
+	case ActionAmend:
+		name += "_amend" + strconv.Itoa(revision)
+	case ActionCancel:
+		name += "_cancel"
+	}
+	return name
+}
+
+// recordOrderChange records an amendment or cancellation file in place of the
+// order's previous file, which is kept in order_file_history along with its
+// contents, which may be nil if it no longer exists or was not written locally.
+func recordOrderChange(db *sql.DB, website string, orderID int, filePath, hash string, action Action, previous []byte) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`
+	INSERT INTO order_file_history(order_id, website, xml_file_created, file_path, replaced_at, contents)
+	SELECT order_id, website, xml_file_created, file_path, ?, ? FROM orders WHERE order_id = ? AND website = ?`,
+		now, previous, orderID, website); err != nil {
+		return err
+	}
+
+	var cancelledAt sql.NullTime
+	if action == ActionCancel {
+		cancelledAt = sql.NullTime{Time: now, Valid: true}
+	}
+	if _, err := tx.Exec(`
+	UPDATE orders SET
+		xml_file_created = ?, file_path = ?, content_hash = ?, revision = revision + 1, cancelled_at = ?,
+		consumed_at = NULL, consumed_via = '', alerted_at = NULL
+	WHERE order_id = ? AND website = ?`,
+		now, filePath, hash, cancelledAt, orderID, website); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// cancelStatusIDs resolves the store's cancel statuses to IDs. Statuses the
+// store does not have are skipped.
+func cancelStatusIDs(source OrderSource, store StoreConfig) ([]int, error) {
+	if store.statuses != nil {
+		return store.statuses.cancel, nil
+	}
+	statuses, err := source.GetOrderStatuses()
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR] getting order statuses: %v", err)
+	}
+
+	names := store.CancelStatuses
+	if len(names) == 0 {
+		names = defaultCancelStatusNames
+	}
+	var statusIDs []int
+	for _, s := range statuses {
+		if slices.ContainsFunc(names, func(ref string) bool { return matchStatus(s, ref) }) {
+			statusIDs = append(statusIDs, s.ID)
+		}
+	}
+	return statusIDs, nil
+}
+
+// syncOrderChange compares an exported order with what was sent for it and
+// writes an amendment or cancellation file if it has changed. It returns the
+// action taken, which is ActionNone if the order was not exported, has already
+// been cancelled or is unchanged.
+func syncOrderChange(db *sql.DB, source OrderSource, store StoreConfig, order bigcommerce.Order, cancelStatusIDs []int) (Action, error) {
+	exported, ok, err := getExportedOrder(db, store.Website, order.ID)
+	if err != nil || !ok || exported.Cancelled {
+		return ActionNone, err
+	}
+
+	action := ActionAmend
+	if slices.Contains(cancelStatusIDs, order.StatusID) {
+		action = ActionCancel
+	}
+
+	// corrections made while the order was in quarantine still apply, and a
+	// cancellation does not need its hire dates
+	var hireJob Order
+	bundle, err := fetchOrderBundle(source, nil, order)
+	if err == nil {
+		var q QuarantinedOrder
+		q, _, err = GetQuarantinedOrder(db, store.Website, order.ID)
+		bundle.Edits = q.Edits
+	}
+	if err == nil && action != ActionCancel {
+		err = bundle.findHireDates(dateSources(db, source, store))
+	}
+	if err == nil {
+		hireJob, _, err = newConverter(store).Convert(bundle)
+	}
+	if err != nil {
+		if action != ActionCancel {
+			return ActionNone, fmt.Errorf("error converting amended order %d: %w", order.ID, err)
+		}
+		// the importer only needs to know which job to cancel
+		log.Printf("[WARNING] cancelling order %d without its details: %v", order.ID, err)
+		hireJob = Order{JobType: store.JobType, WebEnquiryID: strconv.Itoa(order.ID)}
+	}
+
+	hash, err := hireJobHash(hireJob)
+	if err != nil {
+		return ActionNone, err
+	}
+	if action == ActionAmend {
+		if exported.ContentHash == "" {
+			// exported before hashes were kept, so there is nothing to
+			// compare with until now
+			return ActionNone, setContentHash(db, store.Website, order.ID, hash)
+		}
+		if hash == exported.ContentHash {
+			return ActionNone, nil
+		}
+	}
+
+	hireJob.Action = action
+	sink := newSink(store)
+	// only a watched sink's file_path is a local file
+	var previous []byte
+	if sink.Watched() {
+		if previous, err = previousFile(db, store.Website, order.ID); err != nil {
+			return ActionNone, err
+		}
+	}
+	fileName, err := sendOrders(store, sink, changeDocumentName(order.ID, action, exported.Revision+1), []Order{hireJob}, nil)
+	if err != nil {
+		return ActionNone, err
+	}
+	if err := recordOrderChange(db, store.Website, order.ID, fileName, hash, action, previous); err != nil {
+		return ActionNone, err
+	}
+	if !sink.Watched() {
+		if err := markSent(db, store.Website, order.ID); err != nil {
+			return ActionNone, err
+		}
+	}
+	log.Printf("wrote %s for %s order %d to %s", action, store.Website, order.ID, fileName)
+	return action, nil
+}
+
+// syncOrderChanges checks the exported orders among those modified since the
+// sync cursor's last_modified, skipping any handled earlier in the run. It
+// returns the latest change before the first order it could not check, so the
+// next run checks that order again.
+func syncOrderChanges(db *sql.DB, source OrderSource, store StoreConfig, modified []bigcommerce.Order, handled map[int]bool, since time.Time) (time.Time, error) {
+	cancelIDs, err := cancelStatusIDs(source, store)
+	if err != nil {
+		return since, err
+	}
+
+	latest, failed := since, false
+	for _, order := range modified {
+		if !handled[order.ID] {
+			if _, err := syncOrderChange(db, source, store, order, cancelIDs); err != nil {
+				log.Printf("[ERROR] %v", err)
+				failed = true
+			}
+		}
+		if t := parseOrderTime(order.DateModified); !failed && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, nil
+}
+
+// SyncOrderChange checks a single exported order for changes, e.g. from a
+// webhook, and writes an amendment or cancellation file if it has any.
+func SyncOrderChange(db *sql.DB, store StoreConfig, orderID int) (Action, error) {
+	source := NewOrderSource(store)
+	order, err := source.GetOrder(orderID)
+	if err != nil {
+		return ActionNone, fmt.Errorf("[ERROR] getting order %d: %v", orderID, err)
+	}
+
+	cancelIDs, err := cancelStatusIDs(source, store)
+	if err != nil {
+		return ActionNone, err
+	}
+	return syncOrderChange(db, source, store, order, cancelIDs)
+}
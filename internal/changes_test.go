@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+func TestOrderAmendment(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	if err := GenerateFile(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := SyncOrderChange(db, store, 4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionNone {
+		t.Fatalf("expected no change for an unchanged order, got %q", action)
+	}
+
+	fake.updateOrder(4200, func(o *bigcommerce.Order) {
+		o.CustomerMessage = "/**/Delivery Date = Saturday, December 7, 2024;Collection Date = Monday, December 9, 2024;/**/"
+	})
+	action, err = SyncOrderChange(db, store, 4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionAmend {
+		t.Fatalf("expected an amendment, got %q", action)
+	}
+
+	b, err := os.ReadFile(filepath.Join(store.OutputDir, "order4200_amend1.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<Action>Amend</Action>", "07-12-2024"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected the amendment to contain %s, got\n%s", want, b)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(store.OutputDir, "order4200.xml")); err != nil {
+		t.Errorf("expected the original file to be left for the importer: %v", err)
+	}
+
+	exported, _, err := getExportedOrder(db, store.Website, 4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported.Revision != 1 || filepath.Base(exported.FilePath) != "order4200_amend1.xml" {
+		t.Errorf("unexpected export record %+v", exported)
+	}
+
+	var history int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM order_file_history WHERE website = ? AND order_id = ?`, store.Website, 4200).Scan(&history); err != nil {
+		t.Fatal(err)
+	}
+	if history != 1 {
+		t.Errorf("expected the original file in the history, got %d entries", history)
+	}
+
+	if action, err := SyncOrderChange(db, store, 4200); err != nil || action != ActionNone {
+		t.Errorf("expected no second amendment, got %q, %v", action, err)
+	}
+}
+
+func TestOrderCancellation(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	if err := GenerateFile(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.setOrderStatus(4200, 5)
+	action, err := SyncOrderChange(db, store, 4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionCancel {
+		t.Fatalf("expected a cancellation, got %q", action)
+	}
+
+	b, err := os.ReadFile(filepath.Join(store.OutputDir, "order4200_cancel.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<Action>Cancel</Action>") || !strings.Contains(string(b), "<webenquiryid>4200</webenquiryid>") {
+		t.Errorf("unexpected cancellation file\n%s", b)
+	}
+
+	if action, err := SyncOrderChange(db, store, 4200); err != nil || action != ActionNone {
+		t.Errorf("expected a cancelled order to be left alone, got %q, %v", action, err)
+	}
+}
+
+func TestHTTPSinkChangeHistory(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	server := newImportServer(t)
+	db := testDatabase(t)
+	store := testStore("")
+	store.Format = FormatJSON
+	store.Sink = SinkConfig{Type: SinkHTTP, URL: server.URL, Timeout: defaultSinkTimeout}
+
+	if err := GenerateFile(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+
+	// the http sink's file_path is just the document name, which must not be
+	// read from the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.WriteFile("order4200.json", []byte("unrelated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.setOrderStatus(4200, 5)
+	if action, err := SyncOrderChange(db, store, 4200); err != nil || action != ActionCancel {
+		t.Fatalf("expected a cancellation, got %q, %v", action, err)
+	}
+
+	var contents []byte
+	if err := db.QueryRow(`SELECT contents FROM order_file_history WHERE website = ? AND order_id = ?`, store.Website, 4200).Scan(&contents); err != nil {
+		t.Fatal(err)
+	}
+	if contents != nil {
+		t.Errorf("expected no contents for a file that was posted, got %q", contents)
+	}
+}
+
+func TestCancellationWithoutHireDates(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	if err := GenerateFile(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.updateOrder(4200, func(o *bigcommerce.Order) {
+		o.StatusID = 5
+		o.CustomerMessage = "/**/Delivery Date = sometime next week;/**/"
+	})
+	if action, err := SyncOrderChange(db, store, 4200); err != nil || action != ActionCancel {
+		t.Fatalf("expected a cancellation, got %q, %v", action, err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(store.OutputDir, "order4200_cancel.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<Name>Aoife Byrne</Name>") {
+		t.Errorf("expected the cancellation to keep the order's details despite its dates, got\n%s", b)
+	}
+}
+
+func TestReleasedOrderUnchanged(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	fake.updateOrder(4200, func(o *bigcommerce.Order) {
+		o.CustomerMessage = strings.Repeat("please ring the bell ", 30) + o.CustomerMessage
+	})
+	if err := GenerateFile(db, store, 4200); !errors.Is(err, ErrQuarantined) {
+		t.Fatalf("expected order 4200 to be quarantined, got %v", err)
+	}
+	instructions := "Ring the bell"
+	if err := EditQuarantinedOrder(db, store.Website, 4200, QuarantineEdits{DeliveryInstructions: &instructions}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReleaseOrder(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+
+	action, err := SyncOrderChange(db, store, 4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != ActionNone {
+		t.Errorf("expected the released order's edits to be applied when checking it for changes, got %q", action)
+	}
+}
+
+func TestSyncOrderChangesOnRun(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	config := Config{Stores: []StoreConfig{store}}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.updateOrder(4201, func(o *bigcommerce.Order) {
+		o.StatusID = 5
+		o.DateModified = time.Now().Add(time.Hour).Format(time.RFC1123Z)
+	})
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(store.OutputDir, "order4201_cancel.xml")); err != nil {
+		t.Errorf("expected a cancellation for order 4201: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(store.OutputDir, "order4200_*.xml"))
+	if len(matches) != 0 {
+		t.Errorf("expected no change files for order 4200, got %v", matches)
+	}
+}
+
+// unavailableProducts is a source whose order products cannot be fetched while
+// down is set.
+type unavailableProducts struct {
+	*MemoryOrderSource
+	down bool
+}
+
+func (s *unavailableProducts) GetOrderProducts(orderID int, params bigcommerce.OrderProductsQueryParams) ([]bigcommerce.OrderProduct, error) {
+	if s.down {
+		return nil, fmt.Errorf("products for order %d are unavailable", orderID)
+	}
+	return s.MemoryOrderSource.GetOrderProducts(orderID, params)
+}
+
+func TestFailedChangeRetried(t *testing.T) {
+	source := &unavailableProducts{MemoryOrderSource: memorySource(t)}
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	config := Config{Stores: []StoreConfig{store}}
+	opts := GenerateOptions{Source: func(StoreConfig) OrderSource { return source }}
+
+	if err := GenerateFiles(db, config, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	modified := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	source.Orders[0].CustomerMessage = "/**/Delivery Date = Saturday, December 7, 2024;Collection Date = Monday, December 9, 2024;/**/"
+	source.Orders[0].DateModified = modified.Format(time.RFC1123Z)
+	source.down = true
+	if err := GenerateFiles(db, config, opts); err != nil {
+		t.Fatal(err)
+	}
+	amendment := filepath.Join(store.OutputDir, "order4200_amend1.xml")
+	if _, err := os.Stat(amendment); err == nil {
+		t.Fatal("expected no amendment while the order's products are unavailable")
+	}
+	cursor, _, err := GetSyncCursor(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.LastModified.Before(modified) {
+		t.Errorf("expected last modified to stay before the failed change, got %v", cursor.LastModified)
+	}
+
+	source.down = false
+	if err := GenerateFiles(db, config, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(amendment); err != nil {
+		t.Errorf("expected the failed change to be sent on the next run: %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config lists every store that orders are exported from.
+type Config struct {
+	Stores []StoreConfig `yaml:"stores"`
+}
+
+// StoreConfig describes one BigCommerce store and where its orders go.
+type StoreConfig struct {
+	// Website is the name recorded against each order in the orders table.
+	Website   string `yaml:"website"`
+	StoreHash string `yaml:"store_hash"`
+	// TokenEnv names the environment variable holding the store's API token.
+	TokenEnv     string  `yaml:"token_env"`
+	JobType      JobType `yaml:"job_type"`
+	OutputDir    string  `yaml:"output_dir"`
+	StartOrderID int     `yaml:"start_order_id"`
+	// Statuses are the names or IDs of the statuses to export orders in,
+	// or "*" for every status.
+	Statuses []string `yaml:"statuses"`
+	// ExcludeStatuses are names or IDs taken out of Statuses.
+	ExcludeStatuses []string `yaml:"exclude_statuses"`
+	// MaxOrders caps how many orders one run fetches for the store.
+	MaxOrders int  `yaml:"max_orders"`
+	Disabled  bool `yaml:"disabled"`
+	// DateSources are tried in order to find an order's hire dates.
+	DateSources []DateSourceConfig `yaml:"date_sources"`
+	// FileMode and DirMode are the permissions order files and the output
+	// directory are created with, e.g. "0640".
+	FileMode FileMode `yaml:"file_mode"`
+	DirMode  FileMode `yaml:"dir_mode"`
+	// Handoff is none, ready or manifest.
+	Handoff Handoff `yaml:"handoff"`
+	// Format is xml, the default, json or csv.
+	Format Format `yaml:"format"`
+	// Sink is where files are sent, the output directory by default.
+	Sink SinkConfig `yaml:"sink"`
+	// ArchiveDir and ErrorDir are where the importer moves files it has
+	// imported or rejected, if it moves them rather than deleting them.
+	ArchiveDir string `yaml:"archive_dir"`
+	ErrorDir   string `yaml:"error_dir"`
+	// ImportSLA is how long a file can wait to be imported before staff are
+	// alerted, e.g. "30m".
+	ImportSLA time.Duration `yaml:"import_sla"`
+	// WriteBack is what to change on an order in BigCommerce once it has
+	// been exported.
+	WriteBack WriteBackConfig `yaml:"write_back"`
+	// WarningPolicy is emit, block or quarantine.
+	WarningPolicy WarningPolicy `yaml:"warning_policy"`
+	// Batch writes each run's orders to shared files.
+	Batch BatchConfig `yaml:"batch"`
+	// DeliveryRules decide whether an order is delivered or collected. The
+	// first that matches wins.
+	DeliveryRules []DeliveryRule `yaml:"delivery_rules"`
+	// CancelStatuses are the statuses that cancel an exported order.
+	// Statuses the store does not have are ignored.
+	CancelStatuses []string `yaml:"cancel_statuses"`
+
+	AuthToken string `yaml:"-"`
+	// statuses is set by CheckStatuses, so a long running process does not
+	// look them up for every order.
+	statuses *resolvedStatuses
+}
+
+const (
+	defaultStatusName = "Awaiting Fulfillment"
+	defaultMaxOrders  = 500
+)
+
+// LoadConfig reads the store list from a YAML file and resolves each store's
+// API token from the environment. Disabled stores are dropped. A missing token
+// is not an error until CheckTokens, so stores that are not being run do not
+// need one.
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	return parseConfig(b)
+}
+
+func parseConfig(b []byte) (Config, error) {
+	var raw Config
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return Config{}, fmt.Errorf("error parsing config: %w", err)
+	}
+
+	var config Config
+	websites := map[string]bool{}
+	hashes := map[string]bool{}
+	for i, store := range raw.Stores {
+		if store.Disabled {
+			continue
+		}
+
+		if store.Website == "" {
+			return Config{}, fmt.Errorf("store %d: website cannot be empty", i)
+		}
+		if store.StoreHash == "" {
+			return Config{}, fmt.Errorf("store %s: store_hash cannot be empty", store.Website)
+		}
+		if websites[store.Website] {
+			return Config{}, fmt.Errorf("store %s: website is listed more than once", store.Website)
+		}
+		if hashes[store.StoreHash] {
+			return Config{}, fmt.Errorf("store %s: store_hash %s is listed more than once", store.Website, store.StoreHash)
+		}
+		websites[store.Website] = true
+		hashes[store.StoreHash] = true
+
+		if store.JobType < 1 {
+			return Config{}, fmt.Errorf("store %s: job_type must be a positive integer", store.Website)
+		}
+
+		if store.TokenEnv == "" {
+			return Config{}, fmt.Errorf("store %s: token_env cannot be empty", store.Website)
+		}
+		store.AuthToken = os.Getenv(store.TokenEnv)
+
+		if store.OutputDir == "" {
+			store.OutputDir = os.Getenv("FILE_PATH")
+		}
+		if err := store.Sink.validate(); err != nil {
+			return Config{}, fmt.Errorf("store %s: %w", store.Website, err)
+		}
+		if store.OutputDir == "" && store.Sink.Type == SinkLocal {
+			return Config{}, fmt.Errorf("store %s: output_dir cannot be empty", store.Website)
+		}
+		switch store.Format {
+		case "":
+			store.Format = FormatXML
+		case FormatXML, FormatJSON, FormatCSV:
+		default:
+			return Config{}, fmt.Errorf("store %s: format must be xml, json or csv, got %q", store.Website, store.Format)
+		}
+
+		if len(store.Statuses) == 0 {
+			store.Statuses = []string{defaultStatusName}
+		}
+		if slices.Contains(store.Statuses, "") || slices.Contains(store.ExcludeStatuses, "") {
+			return Config{}, fmt.Errorf("store %s: statuses cannot be empty", store.Website)
+		}
+		if slices.Contains(store.ExcludeStatuses, allStatuses) {
+			return Config{}, fmt.Errorf("store %s: exclude_statuses cannot be %q", store.Website, allStatuses)
+		}
+
+		if store.MaxOrders < 0 {
+			return Config{}, fmt.Errorf("store %s: max_orders cannot be negative", store.Website)
+		}
+		if store.MaxOrders == 0 {
+			store.MaxOrders = defaultMaxOrders
+		}
+
+		switch store.Handoff {
+		case "":
+			store.Handoff = HandoffNone
+		case HandoffNone, HandoffReady, HandoffManifest:
+		default:
+			return Config{}, fmt.Errorf("store %s: handoff must be none, ready or manifest, got %q", store.Website, store.Handoff)
+		}
+		if err := store.WriteBack.validate(); err != nil {
+			return Config{}, fmt.Errorf("store %s: %w", store.Website, err)
+		}
+
+		if store.ImportSLA < 0 {
+			return Config{}, fmt.Errorf("store %s: import_sla cannot be negative", store.Website)
+		}
+		if store.ImportSLA == 0 {
+			store.ImportSLA = defaultImportSLA
+		}
+
+		if store.FileMode == 0 {
+			store.FileMode = defaultFileMode
+		}
+		if store.DirMode == 0 {
+			store.DirMode = defaultDirMode
+		}
+
+		switch store.WarningPolicy {
+		case "":
+			store.WarningPolicy = defaultWarningPolicy
+		case WarningPolicyEmit, WarningPolicyBlock, WarningPolicyQuarantine:
+		default:
+			return Config{}, fmt.Errorf("store %s: warning_policy must be emit, block or quarantine, got %q", store.Website, store.WarningPolicy)
+		}
+
+		if store.Batch.MaxOrders < 0 {
+			return Config{}, fmt.Errorf("store %s: batch max_orders cannot be negative", store.Website)
+		}
+
+		if len(store.DeliveryRules) == 0 {
+			store.DeliveryRules = defaultDeliveryRules
+		}
+		rules, err := compileDeliveryRules(store.DeliveryRules)
+		if err != nil {
+			return Config{}, fmt.Errorf("store %s: %w", store.Website, err)
+		}
+		store.DeliveryRules = rules
+
+		if len(store.CancelStatuses) == 0 {
+			store.CancelStatuses = defaultCancelStatusNames
+		}
+
+		if len(store.DateSources) == 0 {
+			store.DateSources = defaultDateSources
+		}
+		for _, source := range store.DateSources {
+			if err := source.validate(); err != nil {
+				return Config{}, fmt.Errorf("store %s: %w", store.Website, err)
+			}
+		}
+
+		config.Stores = append(config.Stores, store)
+	}
+
+	if len(config.Stores) == 0 {
+		return Config{}, fmt.Errorf("no enabled stores in config")
+	}
+
+	return config, nil
+}
+
+// CheckToken confirms that the store's API token was found in the
+// environment.
+func (s StoreConfig) CheckToken() error {
+	if s.AuthToken == "" {
+		return fmt.Errorf("store %s: missing environment variable %s", s.Website, s.TokenEnv)
+	}
+	return nil
+}
+
+// CheckTokens confirms that every store has its API token, once the stores to
+// run have been chosen.
+func (c Config) CheckTokens() error {
+	for _, store := range c.Stores {
+		if err := store.CheckToken(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreByHash finds the store a webhook producer belongs to.
+func (c Config) StoreByHash(storeHash string) (StoreConfig, bool) {
+	for _, store := range c.Stores {
+		if store.StoreHash == storeHash {
+			return store, true
+		}
+	}
+	return StoreConfig{}, false
+}
+
+// StoreByWebsite finds a store by the website name it is recorded under.
+func (c Config) StoreByWebsite(website string) (StoreConfig, bool) {
+	for _, store := range c.Stores {
+		if store.Website == website {
+			return store, true
+		}
+	}
+	return StoreConfig{}, false
+}
+
+// maxOrderIDRange is the most orders a single range in ParseOrderIDs can
+// cover, so a typo cannot ask BigCommerce for millions of orders.
+const maxOrderIDRange = 1000
+
+// ParseOrderIDs parses a comma separated list of order IDs and ID ranges, such
+// as "4200" or "4200-4210,4215".
+func ParseOrderIDs(value string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(value, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid order id %q", part)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(to)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid order id range %q", part)
+			}
+			if end-start+1 > maxOrderIDRange {
+				return nil, fmt.Errorf("order id range %q covers more than %d orders", part, maxOrderIDRange)
+			}
+		}
+
+		for id := start; id <= end; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
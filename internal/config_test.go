@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Setenv("CH_XAUTHTOKEN", "ch-token")
+	t.Setenv("FILE_PATH", "/tmp/orders")
+
+	config, err := parseConfig([]byte(`
+stores:
+  - website: caterhire
+    store_hash: abc123
+    token_env: CH_XAUTHTOKEN
+    job_type: 1
+    start_order_id: 4126
+    file_mode: "0640"
+    delivery_rules:
+      - name: pickup
+        shipping_methods: [Pickup*]
+        delivery_type: collection
+  - website: hireall
+    store_hash: def456
+    token_env: HA_XAUTHTOKEN
+    job_type: 2
+    disabled: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(config.Stores) != 1 {
+		t.Fatalf("expected 1 enabled store, got %d", len(config.Stores))
+	}
+
+	store := config.Stores[0]
+	if store.AuthToken != "ch-token" {
+		t.Errorf("expected auth token from CH_XAUTHTOKEN, got %q", store.AuthToken)
+	}
+	if store.OutputDir != "/tmp/orders" {
+		t.Errorf("expected output dir to fall back to FILE_PATH, got %q", store.OutputDir)
+	}
+	if len(store.Statuses) != 1 || store.Statuses[0] != defaultStatusName {
+		t.Errorf("expected default status %q, got %v", defaultStatusName, store.Statuses)
+	}
+
+	if store.FileMode != 0640 || store.DirMode != defaultDirMode {
+		t.Errorf("expected file mode 0640 and the default dir mode, got %o and %o", store.FileMode, store.DirMode)
+	}
+	if store.Handoff != HandoffNone || store.WarningPolicy != WarningPolicyEmit || len(store.DateSources) != len(defaultDateSources) {
+		t.Errorf("expected default handoff, warning policy and date sources, got %+v", store)
+	}
+
+	if len(store.DeliveryRules) != 1 || store.DeliveryRules[0].DeliveryType != COLLECTION {
+		t.Errorf("expected one collection delivery rule, got %+v", store.DeliveryRules)
+	}
+
+	if store.Format != FormatXML || store.Sink.Type != SinkLocal {
+		t.Errorf("expected xml files in the output directory by default, got %s to %s", store.Format, store.Sink.Type)
+	}
+
+	if _, ok := config.StoreByHash("abc123"); !ok {
+		t.Error("expected to find store by hash abc123")
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	t.Setenv("TOKEN", "token")
+
+	tests := map[string]string{
+		"bad job type": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 0, output_dir: out}`,
+		"duplicate website": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out}
+  - {website: a, store_hash: b, token_env: TOKEN, job_type: 2, output_dir: out}`,
+		"no stores": `stores: []`,
+		"unknown date source": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, date_sources: [{type: calendar}]}`,
+		"incomplete metafields date source": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, date_sources: [{type: metafields, namespace: hire}]}`,
+		"unknown warning policy": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, warning_policy: ignore}`,
+		"exclude every status": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, exclude_statuses: ["*"]}`,
+		"unknown delivery type": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, delivery_rules: [{shipping_methods: [Pickup], delivery_type: courier}]}`,
+		"empty delivery pattern": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, delivery_rules: [{skus: ["SC-*", ""], delivery_type: collection}]}`,
+		"unknown handoff": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, handoff: done}`,
+		"unknown format": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, format: yaml}`,
+		"unknown sink": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, sink: {type: ftp}}`,
+		"http sink without url": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, sink: {type: http}}`,
+		"sftp sink without key": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, sink: {type: sftp, host: hire.example.com, user: hire, known_hosts_file: known_hosts, remote_dir: /import}}`,
+		"local sink without output dir": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, sink: {type: local}}`,
+		"bad file mode": `
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, file_mode: "rw-r--r--"}`,
+	}
+
+	for name, yaml := range tests {
+		if _, err := parseConfig([]byte(yaml)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	_, err := parseConfig([]byte(`
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out, sink: {type: ftps}}`))
+	if err == nil || !strings.Contains(err.Error(), "ftps is not supported") {
+		t.Errorf("expected ftps to be rejected as unsupported, got %v", err)
+	}
+}
+
+func TestMissingTokenOnlyFailsItsStore(t *testing.T) {
+	t.Setenv("TOKEN", "token")
+
+	config, err := parseConfig([]byte(`
+stores:
+  - {website: a, store_hash: a, token_env: TOKEN, job_type: 1, output_dir: out}
+  - {website: b, store_hash: b, token_env: MISSING_TOKEN, job_type: 1, output_dir: out}`))
+	if err != nil {
+		t.Fatalf("expected a missing token not to stop the config loading, got %v", err)
+	}
+	if err := config.CheckTokens(); err == nil || !strings.Contains(err.Error(), "MISSING_TOKEN") {
+		t.Errorf("expected CheckTokens to name the missing variable, got %v", err)
+	}
+
+	a, _ := config.StoreByWebsite("a")
+	if err := (Config{Stores: []StoreConfig{a}}).CheckTokens(); err != nil {
+		t.Errorf("expected store a to run without store b's token, got %v", err)
+	}
+}
+
+func TestParseOrderIDs(t *testing.T) {
+	ids, err := ParseOrderIDs("4200-4202, 4215")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 4 || ids[0] != 4200 || ids[3] != 4215 {
+		t.Errorf("expected 4200 to 4202 and 4215, got %v", ids)
+	}
+
+	for _, value := range []string{"42x", "4210-4200", "1-9999999"} {
+		if _, err := ParseOrderIDs(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
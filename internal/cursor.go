@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SyncCursor records how far GenerateFiles has got through a store's orders.
+// New orders are fetched from after LastOrderID, and orders modified since
+// LastModified are fetched as well, which finds older orders that have only
+// now reached an export status.
+type SyncCursor struct {
+	Website     string
+	LastOrderID int
+	// LastModified is zero until the first run has finished.
+	LastModified time.Time
+	UpdatedAt    time.Time
+}
+
+func scanSyncCursor(row interface{ Scan(...any) error }) (SyncCursor, error) {
+	var c SyncCursor
+	var lastModified sql.NullTime
+	if err := row.Scan(&c.Website, &c.LastOrderID, &lastModified, &c.UpdatedAt); err != nil {
+		return SyncCursor{}, err
+	}
+	c.LastModified = lastModified.Time
+	return c, nil
+}
+
+// GetSyncCursor returns the cursor for a website. The boolean is false if the
+// website has never been synced.
+func GetSyncCursor(db *sql.DB, website string) (SyncCursor, bool, error) {
+	c, err := scanSyncCursor(db.QueryRow(`SELECT website, last_order_id, last_modified, updated_at FROM sync_cursors WHERE website = ?`, website))
+	if err == sql.ErrNoRows {
+		return SyncCursor{}, false, nil
+	}
+	if err != nil {
+		return SyncCursor{}, false, err
+	}
+	return c, true, nil
+}
+
+// SyncCursors returns the cursor for every website that has been synced.
+func SyncCursors(db *sql.DB) ([]SyncCursor, error) {
+	rows, err := db.Query(`SELECT website, last_order_id, last_modified, updated_at FROM sync_cursors ORDER BY website`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cursors []SyncCursor
+	for rows.Next() {
+		c, err := scanSyncCursor(rows)
+		if err != nil {
+			return nil, err
+		}
+		cursors = append(cursors, c)
+	}
+	return cursors, rows.Err()
+}
+
+// AdvanceSyncCursor moves the cursor forward to orderID. It never moves it
+// backwards, so orders can be processed in any order.
+func AdvanceSyncCursor(db *sql.DB, website string, orderID int) error {
+	_, err := db.Exec(`
+	INSERT INTO sync_cursors(website, last_order_id, last_modified, updated_at) VALUES(?, ?, NULL, ?)
+	ON CONFLICT(website) DO UPDATE SET
+		last_order_id = MAX(last_order_id, excluded.last_order_id),
+		updated_at = excluded.updated_at`,
+		website, orderID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error advancing sync cursor for %s: %w", website, err)
+	}
+	return nil
+}
+
+// advanceLastModified moves the cursor's last modified timestamp forward once
+// every order modified before it has been looked at. The cursor must already
+// exist.
+func advanceLastModified(db *sql.DB, website string, lastModified time.Time) error {
+	_, err := db.Exec(`
+	UPDATE sync_cursors SET last_modified = ?, updated_at = ?
+	WHERE website = ? AND (last_modified IS NULL OR last_modified < ?)`,
+		lastModified.UTC(), time.Now().UTC(), website, lastModified.UTC())
+	if err != nil {
+		return fmt.Errorf("error advancing sync cursor for %s: %w", website, err)
+	}
+	return nil
+}
+
+// ResetSyncCursor sets the cursor to lastOrderID, so the next run starts at the
+// order after it. The last modified timestamp is cleared.
+func ResetSyncCursor(db *sql.DB, website string, lastOrderID int) error {
+	_, err := db.Exec(`
+	INSERT INTO sync_cursors(website, last_order_id, last_modified, updated_at) VALUES(?, ?, NULL, ?)
+	ON CONFLICT(website) DO UPDATE SET
+		last_order_id = excluded.last_order_id,
+		last_modified = NULL,
+		updated_at = excluded.updated_at`,
+		website, lastOrderID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error resetting sync cursor for %s: %w", website, err)
+	}
+	return nil
+}
+
+// startOrderID returns the first order ID to request for a store. Without a
+// cursor it carries on from the highest order already in the orders table, or
+// from the store's configured start_order_id.
+func startOrderID(db *sql.DB, store StoreConfig) (int, error) {
+	cursor, ok, err := GetSyncCursor(db, store.Website)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return cursor.LastOrderID + 1, nil
+	}
+
+	var maxOrderID sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(order_id) FROM orders WHERE website = ?`, store.Website).Scan(&maxOrderID); err != nil {
+		return 0, err
+	}
+	if maxOrderID.Valid {
+		return int(maxOrderID.Int64) + 1, nil
+	}
+
+	return store.StartOrderID, nil
+}
+
+// parseOrderTime parses the RFC 1123 timestamps the V2 orders API returns.
+func parseOrderTime(value string) time.Time {
+	t, err := time.Parse(time.RFC1123Z, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
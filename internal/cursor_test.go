@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncCursor(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := Database(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := StoreConfig{Website: "caterhire", StartOrderID: 4126}
+
+	start, err := startOrderID(db, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 4126 {
+		t.Errorf("expected start_order_id 4126 without history, got %d", start)
+	}
+
+	if err := SaveFileCreation(db, 4200, store.Website, "order4200.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveFileCreation(db, 4150, store.Website, "order4150.xml"); err != nil {
+		t.Fatal(err)
+	}
+	start, err = startOrderID(db, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 4201 {
+		t.Errorf("expected to continue after highest exported order 4200, got %d", start)
+	}
+
+	modified := time.Date(2024, 12, 6, 10, 0, 0, 0, time.UTC)
+	if err := AdvanceSyncCursor(db, store.Website, 4300); err != nil {
+		t.Fatal(err)
+	}
+	if err := advanceLastModified(db, store.Website, modified); err != nil {
+		t.Fatal(err)
+	}
+	if err := AdvanceSyncCursor(db, store.Website, 4250); err != nil {
+		t.Fatal(err)
+	}
+	if err := advanceLastModified(db, store.Website, modified.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, ok, err := GetSyncCursor(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("expected a cursor after advancing")
+	}
+	if cursor.LastOrderID != 4300 {
+		t.Errorf("cursor moved backwards: last order id %d", cursor.LastOrderID)
+	}
+	if !cursor.LastModified.Equal(modified) {
+		t.Errorf("cursor moved backwards: last modified %v", cursor.LastModified)
+	}
+
+	if err := ResetSyncCursor(db, store.Website, 4100); err != nil {
+		t.Fatal(err)
+	}
+	start, err = startOrderID(db, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 4101 {
+		t.Errorf("expected reset cursor to start at 4101, got %d", start)
+	}
+}
+
+func TestLateOrderBehindCursor(t *testing.T) {
+	source := memorySource(t)
+	late := source.Orders[3]
+	// a copy of 4200 moves the cursor past 4203, which is still Pending
+	newer := source.Orders[0]
+	newer.ID = 4204
+	source.Orders = append(source.Orders, newer)
+	source.Products[4204] = source.Products[4200]
+	source.ShippingAddresses[4204] = source.ShippingAddresses[4200]
+
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	config := Config{Stores: []StoreConfig{store}}
+	opts := GenerateOptions{Source: func(StoreConfig) OrderSource { return source }}
+
+	if err := GenerateFiles(db, config, opts); err != nil {
+		t.Fatal(err)
+	}
+	cursor, _, err := GetSyncCursor(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.LastOrderID != 4204 || cursor.LastModified.IsZero() {
+		t.Fatalf("expected the first run to record where it got to, got %+v", cursor)
+	}
+
+	modified := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	late.StatusID, late.Status = 11, "Awaiting Fulfillment"
+	late.DateModified = modified.Format(time.RFC1123Z)
+	source.Orders[3] = late
+	if err := GenerateFiles(db, config, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(store.OutputDir, orderDocumentName(4203)+".xml")); err != nil {
+		t.Errorf("expected order 4203 to be exported once it reached an export status: %v", err)
+	}
+	cursor, _, err = GetSyncCursor(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.LastModified.Equal(modified) {
+		t.Errorf("expected last modified to move to order 4203's change %v, got %v", modified, cursor.LastModified)
+	}
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// datesBlock matches the block the checkout appends to the customer message,
+// e.g. "/**/Delivery Date = Friday, December 6, 2024;Collection Date = ...;/**/".
+var datesBlock = regexp.MustCompile(`\*\/(.+);\/\*`)
+
+// CustomerMessage is what the checkout writes into an order's customer message.
+type CustomerMessage struct {
+	DeliveryDate         string `json:"delivery_date"`
+	CollectionDate       string `json:"collection_date"`
+	DeliveryInstructions string `json:"delivery_instructions"`
+	OtherInfo            string `json:"other_info"`
+	// HasDates is false if the message has no dates block at all.
+	HasDates bool `json:"has_dates"`
+}
+
+// ParseCustomerMessage splits a customer message into hire dates, the
+// customer's own delivery instructions and the raw checkout block.
+func ParseCustomerMessage(message string) (CustomerMessage, error) {
+	parsed := CustomerMessage{
+		DeliveryInstructions: strings.TrimSpace(removeComments(message)),
+		OtherInfo:            strings.TrimSpace(extractComments(message)),
+	}
+
+	matches := datesBlock.FindStringSubmatch(message)
+	if len(matches) < 2 {
+		return parsed, nil
+	}
+
+	start, end, err := extractDatesFromCustomerMessage(matches[1])
+	if err != nil {
+		return parsed, err
+	}
+	parsed.DeliveryDate, parsed.CollectionDate, parsed.HasDates = start, end, true
+	return parsed, nil
+}
+
+// CustomerMessageSample is one entry in the customer message corpus under
+// testdata/customer_messages.
+type CustomerMessageSample struct {
+	Source  string          `json:"source"`
+	Message string          `json:"message"`
+	Want    CustomerMessage `json:"want"`
+	// WantError is a substring of the error parsing should fail with.
+	WantError string `json:"want_error,omitempty"`
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)
+	phonePattern = regexp.MustCompile(`\+?\d[\d\s-]{6,}\d`)
+)
+
+// AnonymiseCustomerMessage removes the customer's and delivery names, street
+// addresses, postcodes, email addresses and phone numbers from a message while
+// keeping the checkout block intact.
+func AnonymiseCustomerMessage(order bigcommerce.Order, shippingAddresses []bigcommerce.ShippingAddress) string {
+	names := []string{order.BillingAddress.FirstName, order.BillingAddress.LastName}
+	streets := []string{order.BillingAddress.Street1, order.BillingAddress.Street2}
+	zips := []string{order.BillingAddress.Zip}
+	for _, a := range shippingAddresses {
+		names = append(names, a.FirstName, a.LastName)
+		streets = append(streets, a.Street1, a.Street2)
+		zips = append(zips, a.Zip)
+	}
+
+	message := order.CustomerMessage
+	message = replaceValues(message, streets, "1 Example Street", false)
+	message = replaceValues(message, zips, "A00 B000", false)
+	message = replaceValues(message, names, "Customer", true)
+	message = emailPattern.ReplaceAllString(message, "customer@example.com")
+	message = phonePattern.ReplaceAllStringFunc(message, func(phone string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return '0'
+			}
+			return r
+		}, phone)
+	})
+	return message
+}
+
+// replaceValues replaces each of values in message, ignoring case. words only
+// replaces whole words, so a short name is not replaced inside another word.
+func replaceValues(message string, values []string, replacement string, words bool) string {
+	// longest first, so a value is not left half replaced by a shorter one
+	// inside it
+	values = slices.Clone(values)
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if len(value) <= 1 {
+			continue
+		}
+		pattern := regexp.QuoteMeta(value)
+		if words {
+			pattern = `\b` + pattern + `\b`
+		}
+		message = regexp.MustCompile(`(?i)`+pattern).ReplaceAllLiteralString(message, replacement)
+	}
+	return message
+}
+
+// CaptureSample builds a corpus entry for an order, with the expected values
+// taken from the current parser. They need checking by hand before the
+// sample is committed.
+func CaptureSample(website string, order bigcommerce.Order, shippingAddresses []bigcommerce.ShippingAddress) CustomerMessageSample {
+	message := AnonymiseCustomerMessage(order, shippingAddresses)
+	sample := CustomerMessageSample{
+		Source:  fmt.Sprintf("%s order %d", website, order.ID),
+		Message: message,
+	}
+
+	parsed, err := ParseCustomerMessage(message)
+	sample.Want = parsed
+	if err != nil {
+		sample.WantError = err.Error()
+	}
+	return sample
+}
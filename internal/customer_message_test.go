@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+func loadCustomerMessageSamples(t testing.TB) map[string]CustomerMessageSample {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "customer_messages", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no samples in testdata/customer_messages")
+	}
+
+	samples := map[string]CustomerMessageSample{}
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sample CustomerMessageSample
+		if err := json.Unmarshal(b, &sample); err != nil {
+			t.Fatalf("parsing %s: %v", path, err)
+		}
+		samples[strings.TrimSuffix(filepath.Base(path), ".json")] = sample
+	}
+	return samples
+}
+
+func TestParseCustomerMessageCorpus(t *testing.T) {
+	for name, sample := range loadCustomerMessageSamples(t) {
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseCustomerMessage(sample.Message)
+			if sample.WantError != "" {
+				if err == nil || !strings.Contains(err.Error(), sample.WantError) {
+					t.Errorf("expected an error containing %q, got %v", sample.WantError, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if got != sample.Want {
+				t.Errorf("message %q\n got %+v\nwant %+v", sample.Message, got, sample.Want)
+			}
+		})
+	}
+}
+
+var hireDate = regexp.MustCompile(`^\d{2}-\d{2}-\d{4}$`)
+
+func FuzzParseCustomerMessage(f *testing.F) {
+	for _, sample := range loadCustomerMessageSamples(f) {
+		f.Add(sample.Message)
+	}
+
+	f.Fuzz(func(t *testing.T, message string) {
+		got, err := ParseCustomerMessage(message)
+		if err != nil {
+			if got.HasDates {
+				t.Errorf("HasDates set alongside error %v", err)
+			}
+			return
+		}
+
+		if got.HasDates {
+			if !hireDate.MatchString(got.DeliveryDate) || !hireDate.MatchString(got.CollectionDate) {
+				t.Errorf("dates not in DD-MM-YYYY format: %q, %q", got.DeliveryDate, got.CollectionDate)
+			}
+		} else if got.DeliveryDate != "" || got.CollectionDate != "" {
+			t.Errorf("dates set without a dates block: %+v", got)
+		}
+
+		if !strings.Contains(message, got.OtherInfo) {
+			t.Errorf("OtherInfo %q is not part of the message", got.OtherInfo)
+		}
+	})
+}
+
+func TestAnonymiseCustomerMessage(t *testing.T) {
+	order := bigcommerce.Order{
+		ID:              4200,
+		CustomerMessage: "Ask for aoife byrne, aoife@example.ie or +353 87 555 0100 /**/Delivery Date = Friday, December 6, 2024;Collection Date = Monday, December 9, 2024;/**/",
+		BillingAddress:  bigcommerce.BillingAddress{FirstName: "Aoife", LastName: "Byrne"},
+	}
+
+	sample := CaptureSample("caterhire", order, nil)
+	want := "Ask for Customer Customer, customer@example.com or +000 00 000 0000 /**/Delivery Date = Friday, December 6, 2024;Collection Date = Monday, December 9, 2024;/**/"
+	if sample.Message != want {
+		t.Errorf("got  %q\nwant %q", sample.Message, want)
+	}
+	if sample.Want.DeliveryDate != "06-12-2024" || sample.Want.CollectionDate != "09-12-2024" {
+		t.Errorf("anonymising changed the hire dates: %+v", sample.Want)
+	}
+}
+
+// addressOrder repeats its delivery name and address in the customer message,
+// as customers often do. Its anonymised message is the address_in_message
+// corpus sample.
+var addressOrder = bigcommerce.Order{
+	ID:              4300,
+	CustomerMessage: "Deliver to Ciara Walsh, 14 Seaview Terrace, Apt 2, Dun Laoghaire A96 K2P4, side entrance /**/Delivery Date = Friday, December 6, 2024;Collection Date = Monday, December 9, 2024;/**/",
+	BillingAddress:  bigcommerce.BillingAddress{FirstName: "Aoife", LastName: "Byrne", Street1: "12 Harbour Road", Zip: "D13 X2Y3"},
+}
+
+var addressOrderShipping = []bigcommerce.ShippingAddress{{
+	FirstName: "Ciara",
+	LastName:  "Walsh",
+	Street1:   "14 Seaview Terrace",
+	Street2:   "Apt 2",
+	Zip:       "A96 K2P4",
+}}
+
+func TestAnonymiseShippingAddress(t *testing.T) {
+	sample := CaptureSample("caterhire", addressOrder, addressOrderShipping)
+	for _, value := range []string{"Ciara", "Walsh", "Seaview", "Apt 2", "A96 K2P4"} {
+		if strings.Contains(sample.Message, value) {
+			t.Errorf("expected %q to be removed, got %q", value, sample.Message)
+		}
+	}
+
+	want := loadCustomerMessageSamples(t)["address_in_message"]
+	if sample.Message != want.Message || sample.Want != want.Want {
+		t.Errorf("expected the address_in_message sample, got %+v\nwant %+v", sample, want)
+	}
+}
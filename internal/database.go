@@ -2,38 +2,119 @@ package internal
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-func Database(path *string) (*sql.DB, error) {
+// OpenDatabase opens the sqlite database at path, or data/main.db if path is
+// nil, without applying migrations.
+func OpenDatabase(path *string) (*sql.DB, error) {
+	defaultPath := "data/main.db"
+	if path == nil {
+		path = &defaultPath
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*path), 0755); err != nil {
+		return nil, err
+	}
+
+	return sql.Open("sqlite3", *path)
+}
+
+// ReadOnlyDatabase opens an existing sqlite database, or data/main.db if path
+// is nil, without writing to it. It fails if the schema is not up to date, as
+// it cannot be migrated.
+func ReadOnlyDatabase(path *string) (*sql.DB, error) {
 	defaultPath := "data/main.db"
 	if path == nil {
 		path = &defaultPath
 	}
 
-	db, err := sql.Open("sqlite3", *path)
+	if _, err := os.Stat(*path); err != nil {
+		return nil, fmt.Errorf("%w, run admin migrate up first", err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+*path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if pending > 0 {
+		db.Close()
+		return nil, fmt.Errorf("%s has %d pending migrations, run admin migrate up first", *path, pending)
+	}
+	return db, nil
+}
+
+// Database opens the sqlite database and brings its schema up to date.
+func Database(path *string) (*sql.DB, error) {
+	db, err := OpenDatabase(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := db.Exec(`
-	CREATE TABLE IF NOT EXISTS orders(
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		order_id INTEGER NOT NULL,
-		xml_file_created DATETIME NOT NULL,
-		website TEXT NOT NULL
-	)`); err != nil {
+	if _, err := MigrateUp(db, 0); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
-func SaveFileCreation(db *sql.DB, orderID int, website string) error {
-	if _, err := db.Exec(`INSERT INTO ORDERS(order_id, xml_file_created, website) VALUES(?, ?, ?)`, orderID, time.Now().UTC(), website); err != nil {
+// SaveFileCreation records that a file has been written for an order. It
+// returns ErrAlreadyExported if the order already has one.
+func SaveFileCreation(db *sql.DB, orderID int, website string, filePath string) error {
+	if _, err := db.Exec(`INSERT INTO ORDERS(order_id, xml_file_created, website, file_path) VALUES(?, ?, ?, ?)`, orderID, time.Now().UTC(), website, filePath); err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return ErrAlreadyExported
+		}
 		return err
 	}
 	return nil
 }
+
+// ReplaceFileCreation records that the file for an already exported order has
+// been regenerated. The previous record is moved to order_file_history along
+// with the previous file's contents, which may be nil if it no longer exists.
+func ReplaceFileCreation(db *sql.DB, orderID int, website string, filePath string, previous []byte) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(`
+	INSERT INTO order_file_history(order_id, website, xml_file_created, file_path, replaced_at, contents)
+	SELECT order_id, website, xml_file_created, file_path, ?, ? FROM orders WHERE order_id = ? AND website = ?`,
+		now, previous, orderID, website)
+	if err != nil {
+		return err
+	}
+	archived, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if archived == 0 {
+		_, err = tx.Exec(`INSERT INTO orders(order_id, xml_file_created, website, file_path) VALUES(?, ?, ?, ?)`, orderID, now, website, filePath)
+	} else {
+		// the new file has not been imported yet
+		_, err = tx.Exec(`UPDATE orders SET xml_file_created = ?, file_path = ?, consumed_at = NULL, consumed_via = '', alerted_at = NULL WHERE order_id = ? AND website = ?`, now, filePath, orderID, website)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
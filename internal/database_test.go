@@ -1,16 +1,61 @@
 package internal
 
-import "testing"
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
 
 func TestDatabaseConnection(t *testing.T) {
-	dbURL := "../data/test.db"
+	dbURL := filepath.Join(t.TempDir(), "test.db")
 	db, err := Database(&dbURL)
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer db.Close()
 
-	if err := SaveFileCreation(db, 1, "ch"); err != nil {
+	if err := SaveFileCreation(db, 1, "ch", "order1.xml"); err != nil {
 		t.Fatal(err)
 	}
+
+	if err := SaveFileCreation(db, 1, "ch", "order1.xml"); !errors.Is(err, ErrAlreadyExported) {
+		t.Fatalf("expected ErrAlreadyExported for a duplicate order, got %v", err)
+	}
+
+	if err := SaveFileCreation(db, 1, "ha", "order1.xml"); err != nil {
+		t.Fatalf("the same order id on another website should be allowed: %v", err)
+	}
+}
+
+func TestReplaceFileCreation(t *testing.T) {
+	dbURL := filepath.Join(t.TempDir(), "test.db")
+	db, err := Database(&dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := SaveFileCreation(db, 1, "ch", "order1.xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReplaceFileCreation(db, 1, "ch", "order1.xml", []byte("<Orders></Orders>")); err != nil {
+		t.Fatal(err)
+	}
+
+	var contents []byte
+	if err := db.QueryRow(`SELECT contents FROM order_file_history WHERE order_id = 1 AND website = 'ch'`).Scan(&contents); err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "<Orders></Orders>" {
+		t.Errorf("expected previous contents to be archived, got %q", contents)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders WHERE order_id = 1 AND website = 'ch'`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected a single orders row after replacing, got %d", count)
+	}
 }
@@ -0,0 +1,333 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// hireDateLayout is the format the hire system expects dates in.
+const hireDateLayout = "02-01-2006"
+
+// HireDates are an order's delivery and collection dates, as DD-MM-YYYY.
+type HireDates struct {
+	Delivery   string
+	Collection string
+}
+
+// DateSource finds the hire dates for an order. ok is false if the source has
+// nothing for the order, in which case the next source is tried.
+type DateSource interface {
+	Name() string
+	HireDates(order bigcommerce.Order, products []bigcommerce.OrderProduct) (dates HireDates, ok bool, err error)
+}
+
+// DateSourceConfig configures one entry in a store's date_sources list.
+type DateSourceConfig struct {
+	// Type is one of override, metafields, product_options or
+	// customer_message.
+	Type string `yaml:"type"`
+
+	// metafields
+	Namespace     string `yaml:"namespace"`
+	DeliveryKey   string `yaml:"delivery_key"`
+	CollectionKey string `yaml:"collection_key"`
+
+	// product_options
+	DeliveryOption   string `yaml:"delivery_option"`
+	CollectionOption string `yaml:"collection_option"`
+
+	// Layouts are extra Go time layouts to try when parsing metafield and
+	// product option values.
+	Layouts []string `yaml:"layouts"`
+}
+
+var defaultDateSources = []DateSourceConfig{{Type: "override"}, {Type: "customer_message"}}
+
+func (c DateSourceConfig) validate() error {
+	switch c.Type {
+	case "override", "customer_message":
+	case "metafields":
+		if c.Namespace == "" || c.DeliveryKey == "" || c.CollectionKey == "" {
+			return fmt.Errorf("metafields date source needs namespace, delivery_key and collection_key")
+		}
+	case "product_options":
+		if c.DeliveryOption == "" || c.CollectionOption == "" {
+			return fmt.Errorf("product_options date source needs delivery_option and collection_option")
+		}
+	default:
+		return fmt.Errorf("unknown date source type %q", c.Type)
+	}
+	return nil
+}
+
+// dateSources builds a store's date sources in priority order.
+func dateSources(db *sql.DB, source OrderSource, store StoreConfig) []DateSource {
+	configs := store.DateSources
+	if len(configs) == 0 {
+		configs = defaultDateSources
+	}
+
+	var sources []DateSource
+	for _, c := range configs {
+		layouts := append(slices.Clone(c.Layouts), defaultDateLayouts...)
+		switch c.Type {
+		case "override":
+			sources = append(sources, overrideDates{db: db, website: store.Website})
+		case "metafields":
+			sources = append(sources, metafieldDates{source: source, namespace: c.Namespace, deliveryKey: c.DeliveryKey, collectionKey: c.CollectionKey, layouts: layouts})
+		case "product_options":
+			sources = append(sources, productOptionDates{deliveryOption: c.DeliveryOption, collectionOption: c.CollectionOption, layouts: layouts})
+		case "customer_message":
+			sources = append(sources, customerMessageDates{})
+		}
+	}
+	return sources
+}
+
+// findHireDates asks each source in turn for the order's dates. The boolean is
+// false if none of them had any.
+func findHireDates(sources []DateSource, order bigcommerce.Order, products []bigcommerce.OrderProduct) (HireDates, bool, error) {
+	for _, source := range sources {
+		dates, ok, err := source.HireDates(order, products)
+		if err != nil {
+			return HireDates{}, false, fmt.Errorf("%s: %w", source.Name(), err)
+		}
+		if ok {
+			return dates, true, nil
+		}
+	}
+	return HireDates{}, false, nil
+}
+
+var defaultDateLayouts = []string{
+	"Monday, January 2, 2006",
+	"2006-01-02",
+	"2006-01-02T15:04:05Z07:00",
+	hireDateLayout,
+	"02/01/2006",
+	"Jan 2 2006",
+	"January 2 2006",
+}
+
+var ordinalSuffix = regexp.MustCompile(`(\d)(st|nd|rd|th)\b`)
+
+// Unix timestamps outside these years are not taken to be hire dates, so a
+// number such as 20241206 is not read as a day in 1970.
+var (
+	minUnixHireDate = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	maxUnixHireDate = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+)
+
+// parseHireDate parses a date from a structured field. Unix timestamps, as
+// BigCommerce stores date options, YYYYMMDD and "Dec 6th 2024" style display
+// values are understood as well as the given layouts.
+func parseHireDate(value string, layouts []string) (string, error) {
+	value = strings.TrimSpace(value)
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if t, err := time.Parse("20060102", value); err == nil {
+			return t.Format(hireDateLayout), nil
+		}
+		if unix < minUnixHireDate || unix >= maxUnixHireDate {
+			return "", fmt.Errorf("could not parse date %q", value)
+		}
+		return time.Unix(unix, 0).UTC().Format(hireDateLayout), nil
+	}
+
+	value = ordinalSuffix.ReplaceAllString(value, "$1")
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(hireDateLayout), nil
+		}
+	}
+	return "", fmt.Errorf("could not parse date %q", value)
+}
+
+// customerMessageDates reads the dates block the checkout writes into the
+// customer message.
+type customerMessageDates struct{}
+
+func (customerMessageDates) Name() string { return "customer_message" }
+
+func (customerMessageDates) HireDates(order bigcommerce.Order, _ []bigcommerce.OrderProduct) (HireDates, bool, error) {
+	message, err := ParseCustomerMessage(order.CustomerMessage)
+	if err != nil {
+		return HireDates{}, false, err
+	}
+	return HireDates{Delivery: message.DeliveryDate, Collection: message.CollectionDate}, message.HasDates, nil
+}
+
+// productOptionDates reads the dates from product options, such as a date
+// picker on the hire products. The first product with both options wins.
+type productOptionDates struct {
+	deliveryOption   string
+	collectionOption string
+	layouts          []string
+}
+
+func (productOptionDates) Name() string { return "product_options" }
+
+func (s productOptionDates) HireDates(_ bigcommerce.Order, products []bigcommerce.OrderProduct) (HireDates, bool, error) {
+	for _, p := range products {
+		var delivery, collection string
+		for _, option := range p.ProductOptions {
+			value := option.Value
+			if option.Type != "Date field" && option.DisplayValue != "" {
+				value = option.DisplayValue
+			}
+			switch option.DisplayName {
+			case s.deliveryOption:
+				delivery = value
+			case s.collectionOption:
+				collection = value
+			}
+		}
+		if delivery == "" || collection == "" {
+			continue
+		}
+
+		var dates HireDates
+		var err error
+		if dates.Delivery, err = parseHireDate(delivery, s.layouts); err != nil {
+			return HireDates{}, false, fmt.Errorf("product %d %s: %w", p.ID, s.deliveryOption, err)
+		}
+		if dates.Collection, err = parseHireDate(collection, s.layouts); err != nil {
+			return HireDates{}, false, fmt.Errorf("product %d %s: %w", p.ID, s.collectionOption, err)
+		}
+		return dates, true, nil
+	}
+	return HireDates{}, false, nil
+}
+
+// metafieldDates reads the dates from order metafields, which a checkout app
+// can set through the V3 API.
+type metafieldDates struct {
+	source        OrderSource
+	namespace     string
+	deliveryKey   string
+	collectionKey string
+	layouts       []string
+}
+
+func (metafieldDates) Name() string { return "metafields" }
+
+func (s metafieldDates) HireDates(order bigcommerce.Order, _ []bigcommerce.OrderProduct) (HireDates, bool, error) {
+	metafields, err := s.source.GetOrderMetafields(order.ID, s.namespace)
+	if err != nil {
+		return HireDates{}, false, err
+	}
+
+	var delivery, collection string
+	for _, m := range metafields {
+		switch m.Key {
+		case s.deliveryKey:
+			delivery = m.Value
+		case s.collectionKey:
+			collection = m.Value
+		}
+	}
+	if delivery == "" || collection == "" {
+		return HireDates{}, false, nil
+	}
+
+	var dates HireDates
+	if dates.Delivery, err = parseHireDate(delivery, s.layouts); err != nil {
+		return HireDates{}, false, fmt.Errorf("metafield %s.%s: %w", s.namespace, s.deliveryKey, err)
+	}
+	if dates.Collection, err = parseHireDate(collection, s.layouts); err != nil {
+		return HireDates{}, false, fmt.Errorf("metafield %s.%s: %w", s.namespace, s.collectionKey, err)
+	}
+	return dates, true, nil
+}
+
+// overrideDates reads dates entered by hand with the admin dates command.
+type overrideDates struct {
+	db      *sql.DB
+	website string
+}
+
+func (overrideDates) Name() string { return "override" }
+
+func (s overrideDates) HireDates(order bigcommerce.Order, _ []bigcommerce.OrderProduct) (HireDates, bool, error) {
+	override, ok, err := GetHireDateOverride(s.db, s.website, order.ID)
+	if err != nil || !ok {
+		return HireDates{}, false, err
+	}
+	return HireDates{Delivery: override.DeliveryDate, Collection: override.CollectionDate}, true, nil
+}
+
+// HireDateOverride is a pair of dates entered by hand for an order.
+type HireDateOverride struct {
+	Website        string
+	OrderID        int
+	DeliveryDate   string
+	CollectionDate string
+	Note           string
+	CreatedAt      time.Time
+}
+
+// SetHireDateOverride stores hand entered dates for an order, in DD-MM-YYYY
+// format, replacing any set before.
+func SetHireDateOverride(db *sql.DB, website string, orderID int, deliveryDate, collectionDate, note string) error {
+	for _, date := range []string{deliveryDate, collectionDate} {
+		if _, err := time.Parse(hireDateLayout, date); err != nil {
+			return fmt.Errorf("invalid date %q, expected DD-MM-YYYY", date)
+		}
+	}
+
+	_, err := db.Exec(`
+	INSERT INTO hire_date_overrides(website, order_id, delivery_date, collection_date, note, created_at) VALUES(?, ?, ?, ?, ?, ?)
+	ON CONFLICT(website, order_id) DO UPDATE SET
+		delivery_date = excluded.delivery_date,
+		collection_date = excluded.collection_date,
+		note = excluded.note,
+		created_at = excluded.created_at`,
+		website, orderID, deliveryDate, collectionDate, note, time.Now().UTC())
+	return err
+}
+
+// GetHireDateOverride returns the hand entered dates for an order, if any.
+func GetHireDateOverride(db *sql.DB, website string, orderID int) (HireDateOverride, bool, error) {
+	var o HireDateOverride
+	err := db.QueryRow(`SELECT website, order_id, delivery_date, collection_date, note, created_at FROM hire_date_overrides WHERE website = ? AND order_id = ?`, website, orderID).
+		Scan(&o.Website, &o.OrderID, &o.DeliveryDate, &o.CollectionDate, &o.Note, &o.CreatedAt)
+	if err == sql.ErrNoRows {
+		return HireDateOverride{}, false, nil
+	}
+	if err != nil {
+		return HireDateOverride{}, false, err
+	}
+	return o, true, nil
+}
+
+// HireDateOverrides lists the hand entered dates for a website, or for every
+// website if it is empty.
+func HireDateOverrides(db *sql.DB, website string) ([]HireDateOverride, error) {
+	rows, err := db.Query(`SELECT website, order_id, delivery_date, collection_date, note, created_at FROM hire_date_overrides WHERE ? = '' OR website = ? ORDER BY website, order_id`, website, website)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []HireDateOverride
+	for rows.Next() {
+		var o HireDateOverride
+		if err := rows.Scan(&o.Website, &o.OrderID, &o.DeliveryDate, &o.CollectionDate, &o.Note, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// DeleteHireDateOverride removes the hand entered dates for an order.
+func DeleteHireDateOverride(db *sql.DB, website string, orderID int) error {
+	_, err := db.Exec(`DELETE FROM hire_date_overrides WHERE website = ? AND order_id = ?`, website, orderID)
+	return err
+}
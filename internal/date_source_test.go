@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+func TestParseHireDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Friday, December 6, 2024", "06-12-2024"},
+		{"2024-12-06", "06-12-2024"},
+		{"06-12-2024", "06-12-2024"},
+		{"Dec 6th 2024", "06-12-2024"},
+		{"1733443200", "06-12-2024"},
+		{"20241206", "06-12-2024"},
+	}
+	for _, tt := range tests {
+		got, err := parseHireDate(tt.value, defaultDateLayouts)
+		if err != nil {
+			t.Errorf("parseHireDate(%q): %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseHireDate(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"next Tuesday", "20241306", "86400"} {
+		if _, err := parseHireDate(value, defaultDateLayouts); err == nil {
+			t.Errorf("parseHireDate(%q): expected an error", value)
+		}
+	}
+}
+
+func TestFindHireDates(t *testing.T) {
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.DateSources = []DateSourceConfig{
+		{Type: "override"},
+		{Type: "product_options", DeliveryOption: "Delivery Date", CollectionOption: "Collection Date"},
+		{Type: "customer_message"},
+	}
+	sources := dateSources(db, nil, store)
+
+	order := bigcommerce.Order{
+		ID:              4300,
+		CustomerMessage: "/**/Delivery Date = Friday, December 6, 2024;Collection Date = Monday, December 9, 2024;/**/",
+	}
+	products := []bigcommerce.OrderProduct{
+		{ID: 1},
+		{ID: 2, ProductOptions: []bigcommerce.ProductOption{
+			{DisplayName: "Delivery Date", Type: "Date field", Value: "1733788800", DisplayValue: "Dec 10th 2024"},
+			{DisplayName: "Collection Date", Type: "Date field", Value: "1734048000", DisplayValue: "Dec 13th 2024"},
+		}},
+	}
+
+	// product options come before the customer message
+	dates, ok, err := findHireDates(sources, order, products)
+	if err != nil || !ok {
+		t.Fatalf("findHireDates: %v, %v", ok, err)
+	}
+	if want := (HireDates{"10-12-2024", "13-12-2024"}); dates != want {
+		t.Errorf("got %+v, want %+v from the product options", dates, want)
+	}
+
+	// older orders without the options fall back to the customer message
+	dates, ok, err = findHireDates(sources, order, products[:1])
+	if err != nil || !ok {
+		t.Fatalf("findHireDates: %v, %v", ok, err)
+	}
+	if want := (HireDates{"06-12-2024", "09-12-2024"}); dates != want {
+		t.Errorf("got %+v, want %+v from the customer message", dates, want)
+	}
+
+	// an override beats everything
+	if err := SetHireDateOverride(db, store.Website, order.ID, "07-12-2024", "08-12-2024", "phoned in"); err != nil {
+		t.Fatal(err)
+	}
+	dates, _, err = findHireDates(sources, order, products)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (HireDates{"07-12-2024", "08-12-2024"}); dates != want {
+		t.Errorf("got %+v, want %+v from the override", dates, want)
+	}
+
+	if err := DeleteHireDateOverride(db, store.Website, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := GetHireDateOverride(db, store.Website, order.ID); err != nil || ok {
+		t.Errorf("expected the override to be deleted, got %v, %v", ok, err)
+	}
+
+	_, ok, err = findHireDates(sources, bigcommerce.Order{ID: 4301}, nil)
+	if err != nil || ok {
+		t.Errorf("expected no dates for an order with none, got %v, %v", ok, err)
+	}
+}
+
+func TestSetHireDateOverrideValidatesDates(t *testing.T) {
+	db := testDatabase(t)
+	if err := SetHireDateOverride(db, "caterhire", 4300, "2024-12-06", "09-12-2024", ""); err == nil {
+		t.Error("expected an error for a date not in DD-MM-YYYY format")
+	}
+}
+
+func TestOverrideDatesFixFailedOrder(t *testing.T) {
+	newFakeBigCommerce(t, "testdata/bigcommerce")
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	// 4202's customer message has a date that cannot be parsed
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{OrderIDs: []int{4202}}); err != nil {
+		t.Fatal(err)
+	}
+	if exported, _ := orderExported(db, 4202, store.Website); exported {
+		t.Fatal("expected order 4202 to fail")
+	}
+
+	if err := SetHireDateOverride(db, store.Website, 4202, "06-12-2024", "09-12-2024", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{OrderIDs: []int{4202}}); err != nil {
+		t.Fatal(err)
+	}
+	if exported, _ := orderExported(db, 4202, store.Website); !exported {
+		t.Error("expected order 4202 to be exported with the override dates")
+	}
+}
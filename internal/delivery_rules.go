@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/seanomeara96/go-bigcommerce"
+	"gopkg.in/yaml.v3"
+)
+
+// ParseDelivery parses "delivery" or "collection".
+func ParseDelivery(value string) (Delivery, error) {
+	switch strings.ToLower(value) {
+	case "delivery":
+		return DELIVERY, nil
+	case "collection":
+		return COLLECTION, nil
+	}
+	return 0, fmt.Errorf("delivery type must be delivery or collection, got %q", value)
+}
+
+func (d Delivery) String() string {
+	switch d {
+	case DELIVERY:
+		return "delivery"
+	case COLLECTION:
+		return "collection"
+	}
+	return strconv.Itoa(int(d))
+}
+
+func (d *Delivery) UnmarshalYAML(value *yaml.Node) error {
+	t, err := ParseDelivery(value.Value)
+	if err != nil {
+		return err
+	}
+	*d = t
+	return nil
+}
+
+// DeliveryRule decides whether an order is delivered or collected. Each
+// condition that is set must match, and a condition with several values
+// matches if any of them does. A rule with no conditions matches every order.
+type DeliveryRule struct {
+	Name string `yaml:"name"`
+
+	// ShippingMethods, ShippingZones and SKUs are matched ignoring case and
+	// may use * and ? wildcards, e.g. "Pickup*".
+	ShippingMethods []string `yaml:"shipping_methods"`
+	ShippingZones   []string `yaml:"shipping_zones"`
+	SKUs            []string `yaml:"skus"`
+	// Keywords are looked for anywhere in the customer message, ignoring
+	// case.
+	Keywords []string `yaml:"keywords"`
+	// FreeShipping, if set, matches orders whose shipping cost is, or is
+	// not, zero.
+	FreeShipping *bool `yaml:"free_shipping"`
+
+	// DeliveryType is delivery, the default, or collection.
+	DeliveryType Delivery `yaml:"delivery_type"`
+
+	// shippingMethods, shippingZones and skus are the wildcard patterns
+	// compiled once by compile.
+	shippingMethods, shippingZones, skus []*regexp.Regexp
+}
+
+// compile turns the rule's wildcard patterns into regexps, so they are checked
+// when the config is loaded rather than for every order.
+func (r *DeliveryRule) compile() error {
+	var err error
+	if r.shippingMethods, err = compilePatterns(r.ShippingMethods); err != nil {
+		return fmt.Errorf("shipping_methods: %w", err)
+	}
+	if r.shippingZones, err = compilePatterns(r.ShippingZones); err != nil {
+		return fmt.Errorf("shipping_zones: %w", err)
+	}
+	if r.skus, err = compilePatterns(r.SKUs); err != nil {
+		return fmt.Errorf("skus: %w", err)
+	}
+	return nil
+}
+
+// compileDeliveryRules compiles a copy of each rule, naming the first that
+// fails.
+func compileDeliveryRules(rules []DeliveryRule) ([]DeliveryRule, error) {
+	compiled := slices.Clone(rules)
+	for i := range compiled {
+		if err := compiled[i].compile(); err != nil {
+			return nil, fmt.Errorf("delivery rule %s: %w", ruleName(compiled[i], i), err)
+		}
+	}
+	return compiled, nil
+}
+
+func ruleName(rule DeliveryRule, i int) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return "rule " + strconv.Itoa(i+1)
+}
+
+var (
+	freeShipping = true
+
+	// defaultDeliveryRules are used by stores with no delivery_rules: free
+	// shipping means the customer is collecting, unless it is the flat rate
+	// method, which is delivered.
+	defaultDeliveryRules = mustCompileDeliveryRules([]DeliveryRule{
+		{Name: "flat rate", ShippingMethods: []string{"Flat Rate for Delivery & Collection"}, DeliveryType: DELIVERY},
+		{Name: "free shipping", FreeShipping: &freeShipping, DeliveryType: COLLECTION},
+	})
+)
+
+func mustCompileDeliveryRules(rules []DeliveryRule) []DeliveryRule {
+	compiled, err := compileDeliveryRules(rules)
+	if err != nil {
+		panic(err)
+	}
+	return compiled
+}
+
+// deliveryFacts are the parts of an order delivery rules are checked against.
+type deliveryFacts struct {
+	ShippingMethod  string
+	ShippingZone    string
+	ShippingCost    float64
+	SKUs            []string
+	CustomerMessage string
+}
+
+func newDeliveryFacts(order bigcommerce.Order, shippingAddress bigcommerce.ShippingAddress, products []bigcommerce.OrderProduct) (deliveryFacts, error) {
+	shippingCost, err := strconv.ParseFloat(order.ShippingCostExTax, 64)
+	if err != nil {
+		return deliveryFacts{}, fmt.Errorf("could not parse shipping cost float %s: %v", order.ShippingCostExTax, err)
+	}
+
+	facts := deliveryFacts{
+		ShippingMethod:  shippingAddress.ShippingMethod,
+		ShippingZone:    shippingAddress.ShippingZoneName,
+		ShippingCost:    shippingCost,
+		CustomerMessage: order.CustomerMessage,
+	}
+	for _, p := range products {
+		facts.SKUs = append(facts.SKUs, p.SKU)
+	}
+	return facts, nil
+}
+
+// RuleCheck is the result of checking one delivery rule against an order.
+type RuleCheck struct {
+	Rule    string
+	Matched bool
+	// Detail is the condition that failed, or what matched.
+	Detail string
+}
+
+// DeliveryDecision is how an order's delivery type was decided.
+type DeliveryDecision struct {
+	DeliveryType Delivery
+	// Rule is the name of the rule that matched, or "" if none did and the
+	// order defaulted to delivery.
+	Rule string
+	// Checks are the rules checked, in order, up to the one that matched.
+	Checks []RuleCheck
+}
+
+// decideDeliveryType returns the delivery type of the first rule that matches,
+// or DELIVERY if none do. The rules must have been compiled.
+func decideDeliveryType(rules []DeliveryRule, facts deliveryFacts) DeliveryDecision {
+	if len(rules) == 0 {
+		rules = defaultDeliveryRules
+	}
+
+	decision := DeliveryDecision{DeliveryType: DELIVERY}
+	for i, rule := range rules {
+		name := ruleName(rule, i)
+		matched, detail := rule.match(facts)
+		decision.Checks = append(decision.Checks, RuleCheck{Rule: name, Matched: matched, Detail: detail})
+		if matched {
+			decision.DeliveryType = rule.DeliveryType
+			decision.Rule = name
+			break
+		}
+	}
+	return decision
+}
+
+// match checks each of the rule's conditions in turn, describing the first
+// that fails or, if none do, every one that matched.
+func (r DeliveryRule) match(facts deliveryFacts) (bool, string) {
+	var matched []string
+	if len(r.ShippingMethods) > 0 {
+		if !matchAnyPattern(r.shippingMethods, facts.ShippingMethod) {
+			return false, fmt.Sprintf("shipping method %q is not one of %q", facts.ShippingMethod, r.ShippingMethods)
+		}
+		matched = append(matched, fmt.Sprintf("shipping method %q", facts.ShippingMethod))
+	}
+	if len(r.ShippingZones) > 0 {
+		if !matchAnyPattern(r.shippingZones, facts.ShippingZone) {
+			return false, fmt.Sprintf("shipping zone %q is not one of %q", facts.ShippingZone, r.ShippingZones)
+		}
+		matched = append(matched, fmt.Sprintf("shipping zone %q", facts.ShippingZone))
+	}
+	if len(r.SKUs) > 0 {
+		sku, ok := "", false
+		for _, s := range facts.SKUs {
+			if matchAnyPattern(r.skus, s) {
+				sku, ok = s, true
+				break
+			}
+		}
+		if !ok {
+			return false, fmt.Sprintf("no product SKU is one of %q", r.SKUs)
+		}
+		matched = append(matched, fmt.Sprintf("SKU %q", sku))
+	}
+	if len(r.Keywords) > 0 {
+		message := strings.ToLower(facts.CustomerMessage)
+		keyword, ok := "", false
+		for _, k := range r.Keywords {
+			if strings.Contains(message, strings.ToLower(k)) {
+				keyword, ok = k, true
+				break
+			}
+		}
+		if !ok {
+			return false, fmt.Sprintf("customer message has none of %q", r.Keywords)
+		}
+		matched = append(matched, fmt.Sprintf("customer message contains %q", keyword))
+	}
+	if r.FreeShipping != nil {
+		if free := facts.ShippingCost == 0; free != *r.FreeShipping {
+			return false, fmt.Sprintf("shipping cost is %.2f", facts.ShippingCost)
+		}
+		matched = append(matched, fmt.Sprintf("shipping cost %.2f", facts.ShippingCost))
+	}
+
+	if len(matched) == 0 {
+		return true, "matches every order"
+	}
+	return true, strings.Join(matched, ", ")
+}
+
+// compilePatterns compiles wildcard patterns, where * matches any run of
+// characters and ? any one character, ignoring case.
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("patterns cannot be empty")
+		}
+		expr := regexp.QuoteMeta(pattern)
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		re, err := regexp.Compile(`(?is)^` + expr + `$`)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchAnyPattern reports whether value matches any of the patterns.
+func matchAnyPattern(patterns []*regexp.Regexp, value string) bool {
+	return slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool { return re.MatchString(value) })
+}
+
+// ExplainDeliveryType fetches an order and works out its delivery type with
+// the store's rules, recording why each rule did or did not match.
+func ExplainDeliveryType(store StoreConfig, orderID int) (DeliveryDecision, error) {
+	source := NewOrderSource(store)
+	order, err := source.GetOrder(orderID)
+	if err != nil {
+		return DeliveryDecision{}, fmt.Errorf("error getting order %d: %w", orderID, err)
+	}
+	bundle, err := fetchOrderBundle(source, nil, order)
+	if err != nil {
+		return DeliveryDecision{}, err
+	}
+	if len(bundle.ShippingAddresses) == 0 {
+		return DeliveryDecision{}, fmt.Errorf("no shipping addresses found for order %d", orderID)
+	}
+
+	facts, err := newDeliveryFacts(order, bundle.ShippingAddresses[0], bundle.Products)
+	if err != nil {
+		return DeliveryDecision{}, err
+	}
+	return decideDeliveryType(store.DeliveryRules, facts), nil
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecideDeliveryType(t *testing.T) {
+	paid := false
+	rules := []DeliveryRule{
+		{Name: "pickup", ShippingMethods: []string{"pickup*", "Click & Collect"}, DeliveryType: COLLECTION},
+		{Name: "collection zone", ShippingZones: []string{"Collection"}, DeliveryType: COLLECTION},
+		{Name: "self collect", SKUs: []string{"SC-*"}, DeliveryType: COLLECTION},
+		{Name: "customer collecting", Keywords: []string{"will collect"}, FreeShipping: &paid, DeliveryType: COLLECTION},
+	}
+
+	tests := []struct {
+		name  string
+		rules []DeliveryRule
+		facts deliveryFacts
+		want  Delivery
+		rule  string
+	}{
+		{"default flat rate", nil, deliveryFacts{ShippingMethod: "Flat Rate for Delivery & Collection"}, DELIVERY, "flat rate"},
+		{"default free shipping", nil, deliveryFacts{ShippingMethod: "Pickup In Store"}, COLLECTION, "free shipping"},
+		{"default paid shipping", nil, deliveryFacts{ShippingMethod: "Courier", ShippingCost: 25}, DELIVERY, ""},
+		{"method wildcard", rules, deliveryFacts{ShippingMethod: "Pickup In Store", ShippingCost: 10}, COLLECTION, "pickup"},
+		{"method with slash", []DeliveryRule{{ShippingMethods: []string{"*collect*"}, DeliveryType: COLLECTION}}, deliveryFacts{ShippingMethod: "Delivery / Collect"}, COLLECTION, "rule 1"},
+		{"zone", rules, deliveryFacts{ShippingMethod: "Courier", ShippingZone: "collection"}, COLLECTION, "collection zone"},
+		{"sku", rules, deliveryFacts{ShippingMethod: "Courier", SKUs: []string{"TBL-6", "SC-CHAIR"}}, COLLECTION, "self collect"},
+		{"keyword and paid", rules, deliveryFacts{ShippingMethod: "Courier", ShippingCost: 25, CustomerMessage: "We WILL COLLECT on Friday"}, COLLECTION, "customer collecting"},
+		{"keyword but free", rules, deliveryFacts{ShippingMethod: "Courier", CustomerMessage: "we will collect"}, DELIVERY, ""},
+		{"catch all", []DeliveryRule{{Name: "everything", DeliveryType: COLLECTION}}, deliveryFacts{ShippingMethod: "Courier"}, COLLECTION, "everything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileDeliveryRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decision := decideDeliveryType(rules, tt.facts)
+			if decision.DeliveryType != tt.want || decision.Rule != tt.rule {
+				t.Errorf("expected %s by %q, got %s by %q: %+v", tt.want, tt.rule, decision.DeliveryType, decision.Rule, decision.Checks)
+			}
+		})
+	}
+}
+
+func TestExplainDeliveryType(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	store := testStore(t.TempDir())
+
+	decision, err := ExplainDeliveryType(store, 4201)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.DeliveryType != COLLECTION || decision.Rule != "free shipping" {
+		t.Fatalf("expected collection by free shipping, got %+v", decision)
+	}
+	if len(decision.Checks) != 2 || decision.Checks[0].Matched || !strings.Contains(decision.Checks[0].Detail, `"Pickup In Store"`) {
+		t.Errorf("expected the flat rate rule to be explained as not matching, got %+v", decision.Checks)
+	}
+
+	store.DeliveryRules = mustCompileDeliveryRules([]DeliveryRule{{Name: "dublin", ShippingZones: []string{"Dublin"}, DeliveryType: COLLECTION}})
+	decision, err = ExplainDeliveryType(store, 4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.DeliveryType != COLLECTION || decision.Checks[0].Detail != `shipping zone "Dublin"` {
+		t.Errorf("expected order 4200 to match the dublin rule, got %+v", decision)
+	}
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+// unifiedDiff returns a line based diff of a and b in unified format, or an
+// empty string if they are the same.
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+
+	linesA := strings.Split(strings.TrimSuffix(string(a), "\n"), "\n")
+	linesB := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// linesA[i:] and linesB[j:]
+	lcs := make([][]int, len(linesA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			if linesA[i] == linesB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+		a, b int // line numbers in a and b before this edit
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j]:
+			edits = append(edits, edit{' ', linesA[i], i, j})
+			i++
+			j++
+		case i < len(linesA) && (j == len(linesB) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', linesA[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', linesB[j], i, j})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// grow the hunk until there are more than two contexts' worth of
+		// unchanged lines before the next change
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				end = k + 1
+			} else if k-end >= 2*diffContext {
+				break
+			}
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext, len(edits))
+
+		countA, countB := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				countA++
+			}
+			if e.op != '-' {
+				countB++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", edits[from].a+1, countA, edits[from].b+1, countB)
+		for _, e := range edits[from:to] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			sb.WriteByte('\n')
+		}
+
+		start = to
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,26 @@
+package internal
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []byte("<Orders>\n    <Order>\n        <DeliveryDate>06-12-2024</DeliveryDate>\n    </Order>\n</Orders>")
+	b := []byte("<Orders>\n    <Order>\n        <DeliveryDate>07-12-2024</DeliveryDate>\n    </Order>\n</Orders>")
+
+	if diff := unifiedDiff("a", "b", a, a); diff != "" {
+		t.Errorf("expected no diff for identical input, got\n%s", diff)
+	}
+
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ <Orders>
+     <Order>
+-        <DeliveryDate>06-12-2024</DeliveryDate>
++        <DeliveryDate>07-12-2024</DeliveryDate>
+     </Order>
+ </Orders>
+`
+	if diff := unifiedDiff("a", "b", a, b); diff != want {
+		t.Errorf("unexpected diff\n%s\nwant\n%s", diff, want)
+	}
+}
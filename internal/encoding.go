@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Format is how a store's orders are encoded for the hire system.
+type Format string
+
+const (
+	// FormatXML is the hire job XML the back office importer reads.
+	FormatXML Format = "xml"
+	// FormatJSON is the same orders as JSON, for the hire system's REST
+	// import.
+	FormatJSON Format = "json"
+	// FormatCSV is one row per line item, for finance.
+	FormatCSV Format = "csv"
+)
+
+// Encoder turns converted orders into a document.
+type Encoder interface {
+	Encode(orders Orders) ([]byte, error)
+	// Extension is added to the names of the encoder's documents, e.g.
+	// ".xml".
+	Extension() string
+	ContentType() string
+}
+
+func newEncoder(format Format) Encoder {
+	switch format {
+	case FormatJSON:
+		return jsonEncoder{}
+	case FormatCSV:
+		return csvEncoder{}
+	}
+	return xmlEncoder{}
+}
+
+// xmlEncoder writes hire job XML, checked against the importer's schema.
+type xmlEncoder struct{}
+
+func (xmlEncoder) Encode(orders Orders) ([]byte, error) {
+	data, err := marshalOrders(orders.Orders)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateOrdersXML(data); err != nil {
+		return nil, fmt.Errorf("does not match the importer's schema: %v", err)
+	}
+	return data, nil
+}
+
+func (xmlEncoder) Extension() string   { return ".xml" }
+func (xmlEncoder) ContentType() string { return "application/xml" }
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(orders Orders) ([]byte, error) {
+	return json.MarshalIndent(orders, "", "  ")
+}
+
+func (jsonEncoder) Extension() string   { return ".json" }
+func (jsonEncoder) ContentType() string { return "application/json" }
+
+// csvEncoder writes a row for each line item, repeating the order's details on
+// each. An order with no line items still gets a row.
+type csvEncoder struct{}
+
+var csvHeader = []string{
+	"action", "job_type", "web_enquiry_id", "first_contact_date", "name",
+	"billing_company", "billing_street1", "billing_street2", "billing_city", "billing_state", "billing_zip",
+	"email", "tel_no", "delivery_type", "delivery_name", "delivery_company",
+	"delivery_street1", "delivery_street2", "delivery_city", "delivery_state", "delivery_zip",
+	"delivery_instructions", "delivery_date", "collection_date", "shipping_total", "other_info",
+	"item_id", "item_name", "sku", "quantity", "price", "subtotal",
+}
+
+func (csvEncoder) Encode(orders Orders) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	for _, o := range orders.Orders {
+		order := []string{
+			string(o.Action), strconv.Itoa(int(o.JobType)), o.WebEnquiryID, o.FirstContactDate, o.Name,
+			o.BillingCompany, o.BillingStreet1, o.BillingStreet2, o.BillingCity, o.BillingState, o.BillingZip,
+			o.Email, o.TelNo, o.DeliveryType.String(), o.DeliveryName, o.DeliveryCompany,
+			o.DeliveryStreet1, o.DeliveryStreet2, o.DeliveryCity, o.DeliveryState, o.DeliveryZip,
+			o.DeliveryInstructions, o.DeliveryDate, o.CollectionDate, o.ShippingTotal, o.OtherInfo,
+		}
+		items := o.OrderLineItems.Items
+		if len(items) == 0 {
+			items = []OrderLineItem{{}}
+		}
+		for _, item := range items {
+			row := append(order[:len(order):len(order)], item.ID, item.Name, item.SKU, "", "", "")
+			if item != (OrderLineItem{}) {
+				row[len(row)-3] = strconv.Itoa(item.Quantity)
+				row[len(row)-2] = strconv.FormatFloat(float64(item.Price), 'f', 2, 64)
+				row[len(row)-1] = strconv.FormatFloat(float64(item.Subtotal), 'f', 2, 64)
+			}
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (csvEncoder) Extension() string   { return ".csv" }
+func (csvEncoder) ContentType() string { return "text/csv" }
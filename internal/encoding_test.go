@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testOrders() Orders {
+	return Orders{Orders: []Order{
+		{
+			JobType:      1,
+			WebEnquiryID: "4200",
+			Name:         "Mary Smith",
+			DeliveryType: DELIVERY,
+			DeliveryDate: "06-12-2024",
+			OrderLineItems: OrderLineItems{Items: []OrderLineItem{
+				{ID: "1", Name: "Round table", SKU: "TBL-R", Quantity: 4, Price: 12.5, Subtotal: 50},
+				{ID: "2", Name: "Chair, white", SKU: "CHR-W", Quantity: 20, Price: 1.25, Subtotal: 25},
+			}},
+		},
+		{JobType: 1, WebEnquiryID: "4201", Action: ActionCancel, DeliveryType: COLLECTION},
+	}}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	b, err := jsonEncoder{}.Encode(testOrders())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Orders []map[string]any `json:"orders"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(got.Orders))
+	}
+	first := got.Orders[0]
+	if first["web_enquiry_id"] != "4200" || first["delivery_type"] != float64(DELIVERY) || first["action"] != nil {
+		t.Errorf("unexpected first order %v", first)
+	}
+	if _, ok := first["warnings"]; ok {
+		t.Error("expected warnings to be left out")
+	}
+	if got.Orders[1]["action"] != string(ActionCancel) {
+		t.Errorf("expected the second order to be a cancellation, got %v", got.Orders[1])
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	b, err := csvEncoder{}.Encode(testOrders())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(b))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a header, a row for each line item of 4200 and one for 4201, which
+	// has none
+	if len(records) != 4 {
+		t.Fatalf("expected 4 rows, got %d: %v", len(records), records)
+	}
+	column := map[string]int{}
+	for i, name := range records[0] {
+		column[name] = i
+	}
+
+	tests := []struct {
+		row    int
+		column string
+		want   string
+	}{
+		{1, "web_enquiry_id", "4200"},
+		{1, "delivery_type", "delivery"},
+		{1, "item_name", "Round table"},
+		{1, "price", "12.50"},
+		{2, "web_enquiry_id", "4200"},
+		{2, "item_name", "Chair, white"},
+		{2, "subtotal", "25.00"},
+		{3, "action", "Cancel"},
+		{3, "delivery_type", "collection"},
+		{3, "quantity", ""},
+	}
+	for _, tt := range tests {
+		if got := records[tt.row][column[tt.column]]; got != tt.want {
+			t.Errorf("row %d %s: expected %q, got %q", tt.row, tt.column, tt.want, got)
+		}
+	}
+}
+
+func TestXMLEncoderValidates(t *testing.T) {
+	orders := testOrders()
+	if _, err := (xmlEncoder{}).Encode(orders); err != nil {
+		t.Fatal(err)
+	}
+
+	orders.Orders[0].DeliveryDate = "6/12/2024"
+	if _, err := (xmlEncoder{}).Encode(orders); err == nil || !strings.Contains(err.Error(), "importer's schema") {
+		t.Errorf("expected a schema error, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+const (
+	fakeStoreHash = "fakestore"
+	fakeAuthToken = "fake-token"
+)
+
+// fakeBigCommerce is an in-process stand in for the V2 order endpoints that
+// go-bigcommerce calls, and the V3 order metafield endpoints, serving orders
+// loaded from testdata/bigcommerce.
+type fakeBigCommerce struct {
+	mu                sync.Mutex
+	statuses          []bigcommerce.OrderStatus
+	orders            []bigcommerce.Order
+	products          map[int][]bigcommerce.OrderProduct
+	shippingAddresses map[int][]bigcommerce.ShippingAddress
+	metafields        map[int][]OrderMetafield
+	// requests counts requests by path, e.g. "/orders/4200/products".
+	requests map[string]int
+}
+
+func loadFixture(t *testing.T, dir, name string, dest any) {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, dest); err != nil {
+		t.Fatalf("parsing %s: %v", name, err)
+	}
+}
+
+// newFakeBigCommerce starts a fake serving the fixtures in dir and routes every
+// request go-bigcommerce makes through http.DefaultClient to it until the test
+// ends.
+func newFakeBigCommerce(t *testing.T, dir string) *fakeBigCommerce {
+	t.Helper()
+
+	f := &fakeBigCommerce{requests: map[string]int{}, metafields: map[int][]OrderMetafield{}}
+	loadFixture(t, dir, "order_statuses.json", &f.statuses)
+	loadFixture(t, dir, "orders.json", &f.orders)
+	loadFixture(t, dir, "order_products.json", &f.products)
+	loadFixture(t, dir, "shipping_addresses.json", &f.shippingAddresses)
+
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = rewriteTransport{target: target}
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+
+	return f
+}
+
+// rewriteTransport sends every request to target, whatever host it was for.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (rt rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme = rt.target.Scheme
+	r.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (f *fakeBigCommerce) setOrderStatus(orderID, statusID int) {
+	f.updateOrder(orderID, func(o *bigcommerce.Order) { o.StatusID = statusID })
+}
+
+func (f *fakeBigCommerce) updateOrder(orderID int, update func(*bigcommerce.Order)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, o := range f.orders {
+		if o.ID == orderID {
+			update(&f.orders[i])
+		}
+	}
+}
+
+func (f *fakeBigCommerce) order(orderID int) bigcommerce.Order {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := slices.IndexFunc(f.orders, func(o bigcommerce.Order) bool { return o.ID == orderID })
+	return f.orders[i]
+}
+
+func (f *fakeBigCommerce) orderMetafields(orderID int) []OrderMetafield {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.metafields[orderID])
+}
+
+func (f *fakeBigCommerce) requestCount(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+func (f *fakeBigCommerce) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("x-auth-token") != fakeAuthToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if path, ok := strings.CutPrefix(r.URL.Path, "/stores/"+fakeStoreHash+"/v3"); ok {
+		f.requests["/v3"+path]++
+		f.serveV3(w, r, strings.Split(strings.Trim(path, "/"), "/"))
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/stores/"+fakeStoreHash+"/v2")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f.requests[path]++
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "order_statuses":
+		writeJSON(w, f.statuses)
+
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "orders":
+		f.listOrders(w, r.URL.Query())
+
+	case len(parts) >= 2 && parts[0] == "orders":
+		orderID, err := strconv.Atoi(parts[1])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		i := slices.IndexFunc(f.orders, func(o bigcommerce.Order) bool { return o.ID == orderID })
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && len(parts) == 2:
+			writeJSON(w, f.orders[i])
+		case r.Method == http.MethodPut && len(parts) == 2:
+			var update struct {
+				StatusID   *int    `json:"status_id"`
+				StaffNotes *string `json:"staff_notes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if update.StatusID != nil {
+				f.orders[i].StatusID = *update.StatusID
+			}
+			if update.StaffNotes != nil {
+				f.orders[i].StaffNotes = *update.StaffNotes
+			}
+			writeJSON(w, f.orders[i])
+		case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "products":
+			writePage(w, r.URL.Query(), f.products[orderID])
+		case r.Method == http.MethodGet && len(parts) == 3 && parts[2] == "shipping_addresses":
+			writePage(w, r.URL.Query(), f.shippingAddresses[orderID])
+		default:
+			http.NotFound(w, r)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveV3 handles orders/{id}/metafields and orders/{id}/metafields/{id}.
+func (f *fakeBigCommerce) serveV3(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 3 || parts[0] != "orders" || parts[2] != "metafields" {
+		http.NotFound(w, r)
+		return
+	}
+	orderID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3:
+		namespace := r.URL.Query().Get("namespace")
+		data := []OrderMetafield{}
+		for _, m := range f.metafields[orderID] {
+			if namespace == "" || m.Namespace == namespace {
+				data = append(data, m)
+			}
+		}
+		writeJSON(w, map[string]any{"data": data})
+
+	case (r.Method == http.MethodPost && len(parts) == 3) || (r.Method == http.MethodPut && len(parts) == 4):
+		var m OrderMetafield
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metafields := f.metafields[orderID]
+		if r.Method == http.MethodPost {
+			m.ID = len(metafields) + 1
+			f.metafields[orderID] = append(metafields, m)
+		} else {
+			id, _ := strconv.Atoi(parts[3])
+			i := slices.IndexFunc(metafields, func(m OrderMetafield) bool { return m.ID == id })
+			if i < 0 {
+				http.NotFound(w, r)
+				return
+			}
+			m.ID = id
+			metafields[i] = m
+		}
+		writeJSON(w, map[string]any{"data": m})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeBigCommerce) listOrders(w http.ResponseWriter, query url.Values) {
+	minID, _ := strconv.Atoi(query.Get("min_id"))
+	statusID, hasStatus := query.Get("status_id"), query.Has("status_id")
+	minModified, _ := time.Parse(time.RFC1123Z, query.Get("min_date_modified"))
+
+	var orders []bigcommerce.Order
+	for _, o := range f.orders {
+		if o.ID < minID {
+			continue
+		}
+		if modified, _ := time.Parse(time.RFC1123Z, o.DateModified); modified.Before(minModified) {
+			continue
+		}
+		if hasStatus && strconv.Itoa(o.StatusID) != statusID {
+			continue
+		}
+		orders = append(orders, o)
+	}
+
+	slices.SortFunc(orders, func(a, b bigcommerce.Order) int { return a.ID - b.ID })
+	if query.Get("sort") == "id:desc" {
+		slices.Reverse(orders)
+	}
+
+	writePage(w, query, orders)
+}
+
+// writePage writes one page of items, or a 204 with no body when the page is
+// empty, as the V2 API does.
+func writePage[T any](w http.ResponseWriter, query url.Values, items []T) {
+	page, _ := strconv.Atoi(query.Get("page"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	start := min((page-1)*limit, len(items))
+	end := min(start+limit, len(items))
+	if start == end {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, items[start:end])
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,207 @@
+package internal
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Handoff is how the back office importer is told a file is complete.
+type Handoff string
+
+const (
+	// HandoffNone relies on the rename alone: a file only appears under its
+	// final name once it has been written in full.
+	HandoffNone Handoff = "none"
+	// HandoffReady writes an empty orderN.xml.ready marker after each file.
+	HandoffReady Handoff = "ready"
+	// HandoffManifest writes an orderN.xml.manifest with the file's size and
+	// SHA-256 after each file.
+	HandoffManifest Handoff = "manifest"
+)
+
+const (
+	defaultFileMode   FileMode = 0644
+	defaultDirMode    FileMode = 0755
+	tempFilePrefix             = "."
+	tempFileInfix              = ".tmp-"
+	staleTempFileTime          = time.Hour
+)
+
+// FileMode is a permission setting written as an octal string in the config,
+// e.g. "0640".
+type FileMode os.FileMode
+
+func (m *FileMode) UnmarshalYAML(value *yaml.Node) error {
+	mode, err := strconv.ParseUint(value.Value, 8, 32)
+	if err != nil || mode > 0777 {
+		return fmt.Errorf("invalid permissions %q, expected an octal mode such as 0644", value.Value)
+	}
+	*m = FileMode(mode)
+	return nil
+}
+
+// fileManifest is the contents of a manifest handoff file.
+type fileManifest struct {
+	File      string    `json:"file"`
+	Size      int       `json:"size"`
+	SHA256    string    `json:"sha256"`
+	WrittenAt time.Time `json:"written_at"`
+	// OrderIDs lists the orders in a batch file.
+	OrderIDs []int `json:"order_ids,omitempty"`
+}
+
+// writeFileAtomic writes data to a temp file beside path, syncs it and renames
+// it into place, so a reader sees either the old file, the new one or none,
+// never part of one. The temp file is removed if anything fails.
+func writeFileAtomic(path string, data []byte, fileMode, dirMode FileMode) (err error) {
+	fileMode, dirMode = cmp.Or(fileMode, defaultFileMode), cmp.Or(dirMode, defaultDirMode)
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, os.FileMode(dirMode)); err != nil {
+		return fmt.Errorf("error creating directory %s: %v", dir, err)
+	}
+
+	file, err := os.CreateTemp(dir, tempFilePrefix+filepath.Base(path)+tempFileInfix+"*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file for %s: %v", path, err)
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("error writing to file %s: %v", file.Name(), err)
+	}
+	if err := file.Chmod(os.FileMode(fileMode)); err != nil {
+		return fmt.Errorf("error setting permissions on %s: %v", file.Name(), err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("error syncing file %s: %v", file.Name(), err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing file %s: %v", file.Name(), err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("error renaming %s to %s: %v", file.Name(), path, err)
+	}
+
+	return syncDir(dir)
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening directory %s: %v", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing directory %s: %v", dir, err)
+	}
+	return nil
+}
+
+// putFunc writes a whole file to path, so that a reader never sees part of
+// it, wherever the sink keeps its files.
+type putFunc func(path string, data []byte) error
+
+// localPut writes files to the local filesystem with the store's permissions.
+func localPut(store StoreConfig) putFunc {
+	return func(path string, data []byte) error {
+		return writeFileAtomic(path, data, store.FileMode, store.DirMode)
+	}
+}
+
+// handOff tells the importer fileName is complete, as configured for the
+// store. A batch file always gets a manifest listing its orders, and a ready
+// file last if the store uses them.
+func handOff(store StoreConfig, put putFunc, fileName string, doc Document) error {
+	if doc.OrderIDs != nil {
+		if err := writeManifest(put, fileName, doc.Data, doc.OrderIDs); err != nil {
+			return fmt.Errorf("error writing manifest for %s: %v", fileName, err)
+		}
+		if store.Handoff != HandoffReady {
+			return nil
+		}
+	}
+	if err := writeHandoff(store, put, fileName, doc.Data); err != nil {
+		return fmt.Errorf("error writing handoff for %s: %v", fileName, err)
+	}
+	return nil
+}
+
+// writeHandoff tells the importer fileName is complete, as configured for the
+// store.
+func writeHandoff(store StoreConfig, put putFunc, fileName string, data []byte) error {
+	switch store.Handoff {
+	case HandoffReady:
+		return put(fileName+".ready", nil)
+
+	case HandoffManifest:
+		return writeManifest(put, fileName, data, nil)
+	}
+	return nil
+}
+
+// writeManifest writes fileName.manifest describing fileName and, for a batch
+// file, the orders in it.
+func writeManifest(put putFunc, fileName string, data []byte, orderIDs []int) error {
+	sum := sha256.Sum256(data)
+	manifest, err := json.MarshalIndent(fileManifest{
+		File:      filepath.Base(fileName),
+		Size:      len(data),
+		SHA256:    hex.EncodeToString(sum[:]),
+		WrittenAt: time.Now().UTC(),
+		OrderIDs:  orderIDs,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return put(fileName+".manifest", manifest)
+}
+
+// removeStaleTempFiles deletes temp files left in dir by a write that crashed
+// part way through. Recent ones are left alone in case another process is
+// still writing them.
+func removeStaleTempFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, tempFilePrefix) || !strings.Contains(name, tempFileInfix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) < staleTempFileTime {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		log.Printf("[WARNING] removed temp file %s left by an interrupted write", name)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hireJobXML is the XML for a minimal hire job.
+func hireJobXML(t *testing.T) []byte {
+	t.Helper()
+	b, err := marshalHireJob(Order{JobType: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLocalSinkAtomic(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "import")
+	store := testStore(dir)
+	store.FileMode, store.DirMode = 0640, 0750
+	store.Handoff = HandoffManifest
+
+	data := hireJobXML(t)
+	fileName, err := localSink{store: store}.Send(Document{Name: "order4200.xml", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileName != orderFileName(store, 4200) {
+		t.Errorf("expected %s, got %s", orderFileName(store, 4200), fileName)
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected file mode 0640, got %o", info.Mode().Perm())
+	}
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirInfo.Mode().Perm() != 0750 {
+		t.Errorf("expected dir mode 0750, got %o", dirInfo.Mode().Perm())
+	}
+
+	b, err := os.ReadFile(fileName + ".manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest fileManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.File != "order4200.xml" || manifest.Size != len(data) || len(manifest.SHA256) != 64 {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), tempFileInfix) {
+			t.Errorf("temp file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestLocalSinkReadyMarker(t *testing.T) {
+	store := testStore(t.TempDir())
+	store.Handoff = HandoffReady
+
+	fileName, err := localSink{store: store}.Send(Document{Name: "order4200.xml", Data: hireJobXML(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fileName + ".ready"); err != nil {
+		t.Errorf("expected a ready marker: %v", err)
+	}
+	if _, err := os.Stat(fileName + ".manifest"); !os.IsNotExist(err) {
+		t.Errorf("expected no manifest, got %v", err)
+	}
+}
+
+func TestWriteFileAtomicFailureLeavesNothing(t *testing.T) {
+	dir := t.TempDir()
+	// the rename fails because a directory has the file's name
+	path := filepath.Join(dir, "order4200.xml")
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("<Orders></Orders>\n"), 0, 0); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the directory to be left, got %d entries", len(entries))
+	}
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, ".order4200.xml.tmp-123")
+	recent := filepath.Join(dir, ".order4201.xml.tmp-456")
+	order := filepath.Join(dir, "order4199.xml")
+	for _, name := range []string{stale, recent, order} {
+		if err := os.WriteFile(name, []byte("<Orders>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * staleTempFileTime)
+	for _, name := range []string{stale, order} {
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeStaleTempFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the stale temp file to be removed, got %v", err)
+	}
+	for _, name := range []string{recent, order} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("expected %s to be kept: %v", filepath.Base(name), err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"bytes"
+	"database/sql"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata/golden and schema/orders.xsd")
+
+func testStore(outputDir string) StoreConfig {
+	return StoreConfig{
+		Website:      "caterhire",
+		StoreHash:    fakeStoreHash,
+		AuthToken:    fakeAuthToken,
+		JobType:      1,
+		OutputDir:    outputDir,
+		StartOrderID: 4200,
+		Statuses:     []string{defaultStatusName},
+		MaxOrders:    defaultMaxOrders,
+	}
+}
+
+func testDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := Database(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if diff := unifiedDiff(golden, "got", want, got); diff != "" {
+		t.Errorf("%s does not match its golden file:\n%s", name, diff)
+	}
+}
+
+func TestGenerateFilesEndToEnd(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	outputDir := t.TempDir()
+	config := Config{Stores: []StoreConfig{testStore(outputDir)}}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, orderID := range []int{4200, 4201} {
+		name := "order" + strconv.Itoa(orderID) + ".xml"
+		got, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("expected a file for order %d: %v", orderID, err)
+		}
+		assertGolden(t, name, got)
+
+		exported, err := orderExported(db, orderID, "caterhire")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exported {
+			t.Errorf("expected order %d to be recorded in the orders table", orderID)
+		}
+	}
+
+	// 4202 has an unparseable delivery date and 4203 is still pending
+	for _, name := range []string{"order4202.xml", "order4203.xml"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected no %s, got %v", name, err)
+		}
+	}
+
+	failed, err := FailedOrders(db, "caterhire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].OrderID != 4202 || failed[0].Outcome != OutcomeDateParseFailed {
+		t.Errorf("expected order 4202 to be journalled as %s, got %+v", OutcomeDateParseFailed, failed)
+	}
+
+	cursor, _, err := GetSyncCursor(db, "caterhire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.LastOrderID != 4201 {
+		t.Errorf("expected cursor at 4201, got %d", cursor.LastOrderID)
+	}
+
+	// a second run finds nothing new but retries the failed order once more
+	productRequests := fake.requestCount("/orders/4200/products")
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.requestCount("/orders/4200/products"); n != productRequests {
+		t.Errorf("order 4200 was converted again on the second run")
+	}
+	attempts, err := OrderAttempts(db, "caterhire", 4202)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Errorf("expected failed order 4202 to be retried once, got %d attempts", len(attempts))
+	}
+
+	// once the pending order moves to Awaiting Fulfillment a webhook exports it
+	fake.setOrderStatus(4203, 11)
+	if err := GenerateFile(db, config.Stores[0], 4203); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(outputDir, "order4203.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "order4203.xml", got)
+}
+
+func TestGenerateFilesDryRun(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	outputDir := t.TempDir()
+	config := Config{Stores: []StoreConfig{testStore(outputDir)}}
+
+	var out bytes.Buffer
+	if err := GenerateFiles(db, config, GenerateOptions{DryRun: true, OrderIDs: []int{4200}, Output: &out}); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.ReadFile(filepath.Join("testdata", "golden", "order4200.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(out.Bytes(), want) {
+		t.Errorf("expected the preview to contain the XML for order 4200, got\n%s", out.String())
+	}
+
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("dry run wrote %d files", len(entries))
+	}
+
+	exported, err := orderExported(db, 4200, "caterhire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exported {
+		t.Error("dry run recorded order 4200 in the orders table")
+	}
+}
+
+func TestGenerateFilesDryRunFailure(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	config := Config{Stores: []StoreConfig{testStore(t.TempDir())}}
+
+	// 4202 has an unparseable delivery date
+	var out bytes.Buffer
+	if err := GenerateFiles(db, config, GenerateOptions{DryRun: true, OrderIDs: []int{4200, 4202}, Output: &out}); err == nil {
+		t.Error("expected the dry run to fail when an order cannot be converted")
+	}
+	if !bytes.Contains(out.Bytes(), []byte("order 4200")) || !bytes.Contains(out.Bytes(), []byte("# error: ")) {
+		t.Errorf("expected a preview of 4200 and an error for 4202, got\n%s", out.String())
+	}
+
+	if err := GenerateFiles(db, config, GenerateOptions{DryRun: true, Output: &out}); err == nil {
+		t.Error("expected a full dry run to fail when an order cannot be converted")
+	}
+}
+
+func TestGenerateFilesDryRunReadOnly(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	dbPath := filepath.Join(t.TempDir(), "data", "main.db")
+
+	if _, err := ReadOnlyDatabase(&dbPath); err == nil {
+		t.Error("expected a dry run to refuse a database that does not exist")
+	}
+	if _, err := os.Stat(filepath.Dir(dbPath)); !os.IsNotExist(err) {
+		t.Errorf("expected a dry run not to create the database directory: %v", err)
+	}
+
+	unmigrated, err := OpenDatabase(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unmigrated.Exec(`CREATE TABLE notes(note TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	unmigrated.Close()
+	if _, err := ReadOnlyDatabase(&dbPath); err == nil || !strings.Contains(err.Error(), "migrate") {
+		t.Errorf("expected a dry run to ask for an unmigrated database to be migrated, got %v", err)
+	}
+
+	migrated, err := Database(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated.Close()
+	db, err := ReadOnlyDatabase(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	config := Config{Stores: []StoreConfig{testStore(t.TempDir())}}
+	var out bytes.Buffer
+	if err := GenerateFiles(db, config, GenerateOptions{DryRun: true, OrderIDs: []int{4200}, Output: &out}); err != nil {
+		t.Fatal(err)
+	}
+	// 4202 cannot be converted, which is the only error expected
+	err = GenerateFiles(db, config, GenerateOptions{DryRun: true, Output: &out})
+	if err == nil || !strings.Contains(err.Error(), "1 of") {
+		t.Errorf("expected a read-only dry run to fail only on order 4202, got %v", err)
+	}
+}
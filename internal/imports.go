@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ConsumedVia is how an order file was seen to leave the output directory.
+type ConsumedVia string
+
+const (
+	// ConsumedRemoved means the file was deleted, or moved somewhere the
+	// watcher does not look.
+	ConsumedRemoved ConsumedVia = "removed"
+	// ConsumedArchived means the file was moved to the store's archive_dir.
+	ConsumedArchived ConsumedVia = "archived"
+	// ConsumedError means the importer rejected the file into error_dir.
+	ConsumedError ConsumedVia = "error"
+	// ConsumedSent means the file was handed to the hire system by a sink
+	// the watcher cannot look in, e.g. posted to its REST import or
+	// uploaded over SFTP.
+	ConsumedSent ConsumedVia = "sent"
+)
+
+const defaultImportSLA = time.Hour
+
+// ExportedFile is an order file written to a store's output directory.
+type ExportedFile struct {
+	Website     string
+	OrderID     int
+	FilePath    string
+	CreatedAt   time.Time
+	ConsumedAt  *time.Time
+	ConsumedVia ConsumedVia
+}
+
+// ImportCheck is what one pass over a store's output directory found.
+type ImportCheck struct {
+	// Consumed are the files that have gone since the last check.
+	Consumed []ExportedFile
+	// Rejected are files in the error directory that nobody has been
+	// alerted about yet.
+	Rejected []ExportedFile
+	// Overdue are files still waiting past the store's SLA that nobody has
+	// been alerted about yet.
+	Overdue []ExportedFile
+}
+
+// CheckImports records which of a store's exported files the importer has
+// taken since the last check, and finds the ones that need an alert. Files
+// written before their path was recorded are not tracked.
+func CheckImports(db *sql.DB, store StoreConfig, now time.Time) (ImportCheck, error) {
+	pending, err := PendingImports(db, store.Website)
+	if err != nil {
+		return ImportCheck{}, err
+	}
+
+	var check ImportCheck
+	for _, f := range pending {
+		via, err := fileConsumed(store, f.FilePath)
+		if err != nil {
+			return ImportCheck{}, err
+		}
+		if via == "" {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE orders SET consumed_at = ?, consumed_via = ? WHERE order_id = ? AND website = ?`, now.UTC(), via, f.OrderID, f.Website); err != nil {
+			return ImportCheck{}, fmt.Errorf("error recording import of order %d: %w", f.OrderID, err)
+		}
+		consumedAt := now.UTC()
+		f.ConsumedAt, f.ConsumedVia = &consumedAt, via
+		check.Consumed = append(check.Consumed, f)
+	}
+
+	sla := store.ImportSLA
+	if sla == 0 {
+		sla = defaultImportSLA
+	}
+	if check.Overdue, err = queryExportedFiles(db, `
+	WHERE website = ? AND file_path != '' AND consumed_at IS NULL AND alerted_at IS NULL AND xml_file_created < ?`,
+		store.Website, now.UTC().Add(-sla)); err != nil {
+		return ImportCheck{}, err
+	}
+	if check.Rejected, err = queryExportedFiles(db, `
+	WHERE website = ? AND consumed_via = ? AND alerted_at IS NULL`,
+		store.Website, ConsumedError); err != nil {
+		return ImportCheck{}, err
+	}
+	return check, nil
+}
+
+// fileConsumed reports how the file at path left the output directory, or ""
+// if it is still there.
+func fileConsumed(store StoreConfig, path string) (ConsumedVia, error) {
+	if _, err := os.Stat(path); err == nil {
+		return "", nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	for _, dir := range []struct {
+		path string
+		via  ConsumedVia
+	}{
+		{store.ErrorDir, ConsumedError},
+		{store.ArchiveDir, ConsumedArchived},
+	} {
+		if dir.path == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir.path, filepath.Base(path))); err == nil {
+			return dir.via, nil
+		}
+	}
+	return ConsumedRemoved, nil
+}
+
+// markSent records orders sent by a sink that is not watched as consumed.
+func markSent(db *sql.DB, website string, orderIDs ...int) error {
+	for _, orderID := range orderIDs {
+		if _, err := db.Exec(`UPDATE orders SET consumed_at = ?, consumed_via = ? WHERE order_id = ? AND website = ?`, time.Now().UTC(), ConsumedSent, orderID, website); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkImportAlerted records that staff have been told about these orders, so
+// they are not alerted about again.
+func MarkImportAlerted(db *sql.DB, website string, orderIDs ...int) error {
+	for _, orderID := range orderIDs {
+		if _, err := db.Exec(`UPDATE orders SET alerted_at = ? WHERE order_id = ? AND website = ?`, time.Now().UTC(), orderID, website); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingImports lists the exported files the importer has not taken yet. An
+// empty website lists them for every store.
+func PendingImports(db *sql.DB, website string) ([]ExportedFile, error) {
+	return queryExportedFiles(db, `
+	WHERE (? = '' OR website = ?) AND file_path != '' AND consumed_at IS NULL`, website, website)
+}
+
+func queryExportedFiles(db *sql.DB, where string, args ...any) ([]ExportedFile, error) {
+	rows, err := db.Query(`SELECT website, order_id, file_path, xml_file_created, consumed_at, consumed_via FROM orders `+where+` ORDER BY website, order_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []ExportedFile
+	for rows.Next() {
+		var f ExportedFile
+		if err := rows.Scan(&f.Website, &f.OrderID, &f.FilePath, &f.CreatedAt, &f.ConsumedAt, &f.ConsumedVia); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
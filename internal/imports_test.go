@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckImports(t *testing.T) {
+	db := testDatabase(t)
+	root := t.TempDir()
+	store := testStore(filepath.Join(root, "import"))
+	store.ArchiveDir = filepath.Join(root, "archive")
+	store.ErrorDir = filepath.Join(root, "error")
+	store.ImportSLA = 30 * time.Minute
+	for _, dir := range []string{store.OutputDir, store.ArchiveDir, store.ErrorDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, orderID := range []int{4200, 4201, 4202, 4203} {
+		fileName, err := localSink{store: store}.Send(Document{Name: orderDocumentName(orderID) + ".xml", Data: hireJobXML(t)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveFileCreation(db, orderID, store.Website, fileName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 4200 is archived, 4201 deleted, 4202 rejected and 4203 left waiting
+	move := func(orderID int, dir string) {
+		fileName := orderFileName(store, orderID)
+		if err := os.Rename(fileName, filepath.Join(dir, filepath.Base(fileName))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	move(4200, store.ArchiveDir)
+	if err := os.Remove(orderFileName(store, 4201)); err != nil {
+		t.Fatal(err)
+	}
+	move(4202, store.ErrorDir)
+
+	check, err := CheckImports(db, store, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumed := map[int]ConsumedVia{}
+	for _, f := range check.Consumed {
+		consumed[f.OrderID] = f.ConsumedVia
+	}
+	want := map[int]ConsumedVia{4200: ConsumedArchived, 4201: ConsumedRemoved, 4202: ConsumedError}
+	if len(consumed) != len(want) {
+		t.Fatalf("got consumed %v, want %v", consumed, want)
+	}
+	for orderID, via := range want {
+		if consumed[orderID] != via {
+			t.Errorf("order %d: got %q, want %q", orderID, consumed[orderID], via)
+		}
+	}
+	if len(check.Rejected) != 1 || check.Rejected[0].OrderID != 4202 {
+		t.Errorf("expected order 4202 to be rejected, got %+v", check.Rejected)
+	}
+	if len(check.Overdue) != 0 {
+		t.Errorf("expected nothing overdue yet, got %+v", check.Overdue)
+	}
+	if err := MarkImportAlerted(db, store.Website, 4202); err != nil {
+		t.Fatal(err)
+	}
+
+	// an hour later 4203 is past the SLA, and is only alerted about once
+	later := time.Now().Add(time.Hour)
+	check, err = CheckImports(db, store, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Consumed) != 0 || len(check.Rejected) != 0 {
+		t.Errorf("expected no new imports or rejections, got %+v", check)
+	}
+	if len(check.Overdue) != 1 || check.Overdue[0].OrderID != 4203 {
+		t.Fatalf("expected order 4203 to be overdue, got %+v", check.Overdue)
+	}
+	if err := MarkImportAlerted(db, store.Website, 4203); err != nil {
+		t.Fatal(err)
+	}
+	check, err = CheckImports(db, store, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Overdue) != 0 {
+		t.Errorf("expected order 4203 not to be alerted about twice, got %+v", check.Overdue)
+	}
+
+	pending, err := PendingImports(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].OrderID != 4203 {
+		t.Errorf("expected only order 4203 pending, got %+v", pending)
+	}
+
+	// regenerating a file starts tracking it again
+	if err := ReplaceFileCreation(db, 4200, store.Website, orderFileName(store, 4200), nil); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := PendingImports(db, store.Website); len(pending) != 2 {
+		t.Errorf("expected the regenerated order 4200 to be pending again, got %+v", pending)
+	}
+}
@@ -2,11 +2,16 @@ package internal
 
 import (
 	"database/sql"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -17,26 +22,14 @@ import (
 
 type JobType = int
 
-const CaterHireJobType JobType = 1
-const HireAlljobType JobType = 2
-
-func jobTypeToWebsiteName(jobType JobType) string {
-	if jobType == 1 {
-		return string(CATERHIRE)
-	} else if jobType == 2 {
-		return string(HIREALL)
-	}
-	return ""
-}
-
 type Delivery int
 
 const DELIVERY Delivery = 0
 const COLLECTION Delivery = 1
 
 type Orders struct {
-	XMLName xml.Name `xml:"Orders"`
-	Orders  []Order  `xml:"Order"`
+	XMLName xml.Name `xml:"Orders" json:"-"`
+	Orders  []Order  `xml:"Order" json:"orders" xsd:"minOccurs=1"`
 }
 
 type Address struct {
@@ -48,32 +41,34 @@ type Address struct {
 }
 
 type Order struct {
-	JobType              JobType        `xml:"JobType"`
-	WebEnquiryID         string         `xml:"webenquiryid"`
-	FirstContactDate     string         `xml:"FirstContactDate"`
-	Name                 string         `xml:"Name"`
-	BillingCompany       string         `xml:"BillingCompany"`
-	BillingStreet1       string         `xml:"BillingStreet1"`
-	BillingStreet2       string         `xml:"BillingStreet2"`
-	BillingCity          string         `xml:"BillingCity"`
-	BillingState         string         `xml:"BillingState"`
-	BillingZip           string         `xml:"BillingZip"`
-	Email                string         `xml:"Email"`
-	TelNo                string         `xml:"TelNo"`
-	DeliveryType         Delivery       `xml:"DeliveryType"`
-	DeliveryName         string         `xml:"Deliveryname"`
-	DeliveryCompany      string         `xml:"DeliveryCompany"`
-	DeliveryStreet1      string         `xml:"DeliveryStreet1"`
-	DeliveryStreet2      string         `xml:"DeliveryStreet2"`
-	DeliveryCity         string         `xml:"DeliveryCity"`
-	DeliveryState        string         `xml:"DeliveryState"`
-	DeliveryZip          string         `xml:"DeliveryZip"`
-	DeliveryInstructions string         `xml:"Deliveryinstructions"`
-	DeliveryDate         string         `xml:"DeliveryDate"`
-	CollectionDate       string         `xml:"CollectionDate"`
-	ShippingTotal        string         `xml:"ShippingTotal"`
-	OrderLineItems       OrderLineItems `xml:"OrderLineItems"`
-	OtherInfo            string         `xml:"OtherInfo"`
+	// Action is only set on amendment and cancellation files.
+	Action               Action         `xml:"Action,omitempty" json:"action,omitempty"`
+	JobType              JobType        `xml:"JobType" json:"job_type" xsd:"minInclusive=1"`
+	WebEnquiryID         string         `xml:"webenquiryid" json:"web_enquiry_id"`
+	FirstContactDate     string         `xml:"FirstContactDate" json:"first_contact_date" xsd:"pattern=(\\d{2}-\\d{2}-\\d{4})?"`
+	Name                 string         `xml:"Name" json:"name"`
+	BillingCompany       string         `xml:"BillingCompany" json:"billing_company"`
+	BillingStreet1       string         `xml:"BillingStreet1" json:"billing_street1"`
+	BillingStreet2       string         `xml:"BillingStreet2" json:"billing_street2"`
+	BillingCity          string         `xml:"BillingCity" json:"billing_city"`
+	BillingState         string         `xml:"BillingState" json:"billing_state"`
+	BillingZip           string         `xml:"BillingZip" json:"billing_zip"`
+	Email                string         `xml:"Email" json:"email"`
+	TelNo                string         `xml:"TelNo" json:"tel_no"`
+	DeliveryType         Delivery       `xml:"DeliveryType" json:"delivery_type"`
+	DeliveryName         string         `xml:"Deliveryname" json:"delivery_name"`
+	DeliveryCompany      string         `xml:"DeliveryCompany" json:"delivery_company"`
+	DeliveryStreet1      string         `xml:"DeliveryStreet1" json:"delivery_street1"`
+	DeliveryStreet2      string         `xml:"DeliveryStreet2" json:"delivery_street2"`
+	DeliveryCity         string         `xml:"DeliveryCity" json:"delivery_city"`
+	DeliveryState        string         `xml:"DeliveryState" json:"delivery_state"`
+	DeliveryZip          string         `xml:"DeliveryZip" json:"delivery_zip"`
+	DeliveryInstructions string         `xml:"Deliveryinstructions" json:"delivery_instructions" xsd:"maxLength=512"`
+	DeliveryDate         string         `xml:"DeliveryDate" json:"delivery_date" xsd:"pattern=(\\d{2}-\\d{2}-\\d{4})?"`
+	CollectionDate       string         `xml:"CollectionDate" json:"collection_date" xsd:"pattern=(\\d{2}-\\d{2}-\\d{4})?"`
+	ShippingTotal        string         `xml:"ShippingTotal" json:"shipping_total"`
+	OrderLineItems       OrderLineItems `xml:"OrderLineItems" json:"order_line_items"`
+	OtherInfo            string         `xml:"OtherInfo" json:"other_info"`
 }
 
 func (o Order) Validate() error {
@@ -81,24 +76,40 @@ func (o Order) Validate() error {
 		return fmt.Errorf("too many characters in order comment")
 	}
 
-	if o.JobType != CaterHireJobType && o.JobType != HireAlljobType {
-		return fmt.Errorf("expected jobtype code %d or %d. got %d instead", CaterHireJobType, HireAlljobType, o.JobType)
+	if o.JobType < 1 {
+		return fmt.Errorf("expected a positive jobtype code. got %d instead", o.JobType)
 	}
 
 	return nil
 }
 
 type OrderLineItems struct {
-	Items []OrderLineItem `xml:"OrderLineItem"`
+	Items []OrderLineItem `xml:"OrderLineItem" json:"items"`
 }
 
 type OrderLineItem struct {
-	ID       string  `xml:"Id"`
-	Name     string  `xml:"Name"`
-	SKU      string  `xml:"SKU"`
-	Quantity int     `xml:"Quantity"`
-	Price    float64 `xml:"Price"`
-	Subtotal float64 `xml:"Subtotal"`
+	ID       string  `xml:"Id" json:"id"`
+	Name     string  `xml:"Name" json:"name"`
+	SKU      string  `xml:"SKU" json:"sku"`
+	Quantity int     `xml:"Quantity" json:"quantity"`
+	Price    Decimal `xml:"Price" json:"price"`
+	Subtotal Decimal `xml:"Subtotal" json:"subtotal"`
+}
+
+// Decimal is an amount written out without an exponent, which xs:decimal does
+// not allow but encoding/xml uses for very large or small floats.
+type Decimal float64
+
+func (d Decimal) String() string {
+	return strconv.FormatFloat(float64(d), 'f', -1, 64)
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
 }
 
 func ConvertOrderProductToItem(op bigcommerce.OrderProduct) (OrderLineItem, error) {
@@ -116,8 +127,8 @@ func ConvertOrderProductToItem(op bigcommerce.OrderProduct) (OrderLineItem, erro
 		Name:     op.Name,
 		SKU:      op.SKU,
 		Quantity: op.Quantity,
-		Price:    price,
-		Subtotal: subtotal,
+		Price:    Decimal(price),
+		Subtotal: Decimal(subtotal),
 	}, nil
 }
 
@@ -152,7 +163,7 @@ func ConvertOrderToHireJob(startDate, endDate string, order bigcommerce.Order, d
 	deliveryInstructions := strings.TrimSpace(removeComments(order.CustomerMessage))
 	otherInfo := strings.TrimSpace(extractComments(order.CustomerMessage))
 
-	return Order{
+	hireJob := Order{
 		WebEnquiryID:         fmt.Sprintf("%d", order.ID),
 		FirstContactDate:     startDate, // Assuming FirstContactDate is the same as StartDate
 		Name:                 billingName,
@@ -178,7 +189,8 @@ func ConvertOrderToHireJob(startDate, endDate string, order bigcommerce.Order, d
 		ShippingTotal:        order.ShippingCostExTax,
 		OrderLineItems:       OrderLineItems{Items: items},
 		DeliveryType:         deliveryType,
-	}, nil
+	}
+	return hireJob, nil
 }
 
 func extractDatesFromCustomerMessage(customerMessage string) (startDate string, endDate string, err error) {
@@ -220,45 +232,44 @@ func extractDatesFromCustomerMessage(customerMessage string) (startDate string,
 	return startDate, endDate, nil
 }
 
-func xmlToFile(fileName string, data []byte) error {
-	file, err := os.Create(fileName)
+// sendOrders encodes orders in the store's format and sends them to its sink,
+// returning where they went. name is the file name without its extension, and
+// orderIDs are only set for a batch.
+func sendOrders(store StoreConfig, sink Sink, name string, hireJobs []Order, orderIDs []int) (string, error) {
+	encoder := newEncoder(store.Format)
+	name += encoder.Extension()
+	data, err := encoder.Encode(Orders{Orders: hireJobs})
 	if err != nil {
-		return fmt.Errorf("error creating file %s: %v", fileName, err)
-	}
-	defer file.Close()
-
-	if _, err := file.Write(data); err != nil {
-		return fmt.Errorf("error writing to file %s: %v", fileName, err)
+		return "", attemptError(OutcomeValidationFailed, "%s %v", name, err)
 	}
-
-	return nil
+	return sink.Send(Document{Name: name, Data: data, ContentType: encoder.ContentType(), OrderIDs: orderIDs})
 }
 
-func orderToXML(client *bigcommerce.Client, jobType JobType, order bigcommerce.Order) ([]byte, error) {
-
-	startDate, endDate := "", ""
-	integerStringExp := regexp.MustCompile(`\*\/(.+);\/\*`)
-	matches := integerStringExp.FindStringSubmatch(order.CustomerMessage)
-	if len(matches) < 2 {
-		log.Printf("[WARNING] no match found for order %d customer message: %s", order.ID, order.CustomerMessage)
-	} else {
-		integerString := matches[1]
-		start, end, err := extractDatesFromCustomerMessage(integerString)
-		if err != nil {
-			return nil, fmt.Errorf("error extracting dates for order %d: %v", order.ID, err)
-		}
-		startDate, endDate = start, end
-	}
+// OrderBundle is everything needed to convert one order: what was fetched
+// from BigCommerce, the hire dates found for it and any edits made in
+// quarantine. The fetched data is kept with quarantined orders so they can be
+// released without fetching them again.
+type OrderBundle struct {
+	Order             bigcommerce.Order
+	Products          []bigcommerce.OrderProduct
+	ShippingAddresses []bigcommerce.ShippingAddress
+	// Dates are empty if no date source had any.
+	Dates HireDates       `json:"-"`
+	Edits QuarantineEdits `json:"-"`
+}
 
+// fetchOrderBundle fetches an order's products and shipping addresses and
+// finds its hire dates. dates is nil when only the order's details are needed.
+func fetchOrderBundle(source OrderSource, dates []DateSource, order bigcommerce.Order) (OrderBundle, error) {
 	var (
 		page     = 1
 		limit    = 50
 		products = []bigcommerce.OrderProduct{}
 	)
 	for {
-		batch, _, err := client.V2.GetOrderProducts(order.ID, bigcommerce.OrderProductsQueryParams{Page: page, Limit: limit})
+		batch, err := source.GetOrderProducts(order.ID, bigcommerce.OrderProductsQueryParams{Page: page, Limit: limit})
 		if err != nil {
-			return nil, fmt.Errorf("error getting order products for order %d: %v", order.ID, err)
+			return OrderBundle{}, attemptError(OutcomeFetchFailed, "error getting order products for order %d: %v", order.ID, err)
 		}
 		products = append(products, batch...)
 		if len(batch) < limit {
@@ -267,111 +278,808 @@ func orderToXML(client *bigcommerce.Client, jobType JobType, order bigcommerce.O
 		page++
 	}
 
-	deliveryType := DELIVERY
-
-	shippingCost, err := strconv.ParseFloat(order.ShippingCostExTax, 64)
+	shippingAddresses, err := source.GetOrderShippingAddresses(order.ID)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse shipping cost float %s: %v", order.ShippingCostExTax, err)
+		return OrderBundle{}, attemptError(OutcomeFetchFailed, "error getting shipping addresses for order %d: %v", order.ID, err)
+	}
+
+	bundle := OrderBundle{Order: order, Products: products, ShippingAddresses: shippingAddresses}
+	if dates == nil {
+		return bundle, nil
+	}
+	if err := bundle.findHireDates(dates); err != nil {
+		return OrderBundle{}, err
 	}
+	return bundle, nil
+}
 
-	shippingAddresses, err := client.V2.GetOrderShippingAddress(order.ID, bigcommerce.ShippingAddressQueryParams{})
+// findHireDates asks the date sources for the order's hire dates, unless both
+// have been edited in quarantine.
+func (b *OrderBundle) findHireDates(sources []DateSource) error {
+	if b.Edits.DeliveryDate != nil && b.Edits.CollectionDate != nil {
+		return nil
+	}
+	dates, ok, err := findHireDates(sources, b.Order, b.Products)
 	if err != nil {
-		return nil, fmt.Errorf("error getting shipping addresses for order %d: %v", order.ID, err)
+		outcome := OutcomeDateParseFailed
+		var attemptErr *AttemptError
+		if errors.As(err, &attemptErr) {
+			outcome = attemptErr.Outcome
+		}
+		return attemptError(outcome, "error extracting dates for order %d: %v", b.Order.ID, err)
+	}
+	if !ok {
+		log.Printf("no hire dates found for order %d, customer message: %s", b.Order.ID, b.Order.CustomerMessage)
+	}
+	b.Dates = dates
+	return nil
+}
+
+// Converter turns order bundles into a store's hire jobs. It does no I/O, so
+// the same bundle always converts to the same hire job.
+type Converter struct {
+	JobType       JobType
+	DeliveryRules []DeliveryRule
+}
+
+func newConverter(store StoreConfig) Converter {
+	return Converter{JobType: store.JobType, DeliveryRules: store.DeliveryRules}
+}
+
+// Convert builds the hire job for an order, with any edits made to it in
+// quarantine applied, and checks it is valid. It returns the hire job's
+// warnings alongside it, as they are not part of the export; see
+// applyWarningPolicy.
+func (c Converter) Convert(bundle OrderBundle) (Order, []Warning, error) {
+	order, edits := bundle.Order, bundle.Edits
+
+	dates := bundle.Dates
+	if edits.DeliveryDate != nil {
+		dates.Delivery = *edits.DeliveryDate
+	}
+	if edits.CollectionDate != nil {
+		dates.Collection = *edits.CollectionDate
 	}
 
-	if len(shippingAddresses) == 0 {
-		return nil, fmt.Errorf("no shipping addresses found for order %d", order.ID)
+	if len(bundle.ShippingAddresses) == 0 {
+		return Order{}, nil, attemptError(OutcomeValidationFailed, "no shipping addresses found for order %d", order.ID)
 	}
 
-	shippingAddress := shippingAddresses[0]
+	shippingAddress := bundle.ShippingAddresses[0]
 
-	if shippingAddress.ShippingMethod != "Flat Rate for Delivery & Collection" && shippingCost == 0.00 {
-		deliveryType = COLLECTION
+	facts, err := newDeliveryFacts(order, shippingAddress, bundle.Products)
+	if err != nil {
+		return Order{}, nil, attemptError(OutcomeValidationFailed, "%v", err)
+	}
+	deliveryType := decideDeliveryType(c.DeliveryRules, facts).DeliveryType
+	if edits.DeliveryType != nil {
+		deliveryType = *edits.DeliveryType
 	}
 
-	hireJob, err := ConvertOrderToHireJob(startDate, endDate, order, deliveryType, shippingAddress, products)
+	hireJob, err := ConvertOrderToHireJob(dates.Delivery, dates.Collection, order, deliveryType, shippingAddress, bundle.Products)
 	if err != nil {
-		return nil, fmt.Errorf("error converting order %d to hire job: %v", order.ID, err)
+		return Order{}, nil, attemptError(OutcomeValidationFailed, "error converting order %d to hire job: %v", order.ID, err)
+	}
+	if edits.DeliveryInstructions != nil {
+		hireJob.DeliveryInstructions = *edits.DeliveryInstructions
 	}
 
-	hireJob.JobType = jobType
+	hireJob.JobType = c.JobType
 	if err := hireJob.Validate(); err != nil {
-		return nil, err
+		return Order{}, nil, attemptError(OutcomeValidationFailed, "order %d failed validation: %v", order.ID, err)
 	}
 
-	var orders Orders
-	orders.Orders = append(orders.Orders, hireJob)
+	return hireJob, hireJob.warnings(), nil
+}
+
+func marshalHireJob(hireJob Order) ([]byte, error) {
+	return marshalOrders([]Order{hireJob})
+}
+
+func marshalOrders(hireJobs []Order) ([]byte, error) {
+	orders := Orders{Orders: hireJobs}
 	b, err := xml.MarshalIndent(orders, "", "    ")
 	if err != nil {
-		log.Fatalf("error marshalling all orders to XML: %v", err)
+		return nil, fmt.Errorf("error marshalling orders to XML: %v", err)
 	}
-
 	return b, nil
 }
 
-type GenerateFilesConfig struct {
-	JobType    JobType
-	StoreHash  string
-	AuthToken  string
-	MinOrderID int
+// hireJobHash is the content hash of a hire job's XML.
+func hireJobHash(hireJob Order) (string, error) {
+	b, err := marshalHireJob(hireJob)
+	if err != nil {
+		return "", err
+	}
+	return contentHash(b), nil
 }
 
-func GenerateFiles(db *sql.DB, fileDestination string, config GenerateFilesConfig) error {
-	client := bigcommerce.NewClient(config.StoreHash, config.AuthToken, nil, nil)
-	statuses, err := client.V2.GetOrderStatuses()
+// encodeOrder fetches, converts and encodes a single order.
+func encodeOrder(source OrderSource, encoder Encoder, converter Converter, dates []DateSource, order bigcommerce.Order) ([]byte, []Warning, error) {
+	bundle, err := fetchOrderBundle(source, dates, order)
 	if err != nil {
-		return fmt.Errorf("[ERROR] getting order statuses: %v", err)
+		return nil, nil, err
 	}
 
-	statusID := 11
-	for _, s := range statuses {
-		if s.Name == "Awaiting Fulfillment" {
-			statusID = s.ID
-			break
-		}
+	hireJob, warnings, err := converter.Convert(bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := encoder.Encode(Orders{Orders: []Order{hireJob}})
+	if err != nil {
+		return nil, warnings, attemptError(OutcomeValidationFailed, "order %d: %v", order.ID, err)
+	}
+	return doc, warnings, nil
+}
+
+var (
+	ErrAlreadyExported = errors.New("order has already been exported")
+	ErrOrderNotReady   = errors.New("order is not in an export status")
+)
+
+func orderExported(db *sql.DB, orderID int, website string) (bool, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders WHERE order_id = ? AND website = ?`, orderID, website).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// orderDocumentName is an order's file name, without the extension its
+// store's format adds.
+func orderDocumentName(orderID int) string {
+	return "order" + strconv.Itoa(orderID)
+}
+
+// orderFileName is where an order's file is written in the store's output
+// directory.
+func orderFileName(store StoreConfig, orderID int) string {
+	return filepath.Join(store.OutputDir, orderDocumentName(orderID)+newEncoder(store.Format).Extension())
+}
+
+// ordersPageLimit is the largest page size the V2 orders API allows.
+const ordersPageLimit = 250
+
+// runSummary counts what happened to the orders fetched for one store.
+type runSummary struct {
+	fetched   int
+	converted int
+	skipped   int
+	failed    int
+}
+
+// count records the result of exporting one order.
+func (s *runSummary) count(err error) {
+	if err != nil {
+		s.failed++
+	} else {
+		s.converted++
 	}
+}
+
+// isEmptyResponse reports whether err came from decoding the empty body the V2
+// API sends with a 204 when there are no more results.
+func isEmptyResponse(err error) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.Offset == 0
+}
 
+// fetchOrders pages through every order with one of statusIDs from minOrderID
+// upwards, in ascending ID order, stopping once maxOrders have been fetched.
+func fetchOrders(source OrderSource, minOrderID int, statusIDs []int, maxOrders int) ([]bigcommerce.Order, error) {
 	orderSortParams := bigcommerce.OrderSortQuery{
 		Field:     bigcommerce.OrderSortFieldID,
-		Direction: bigcommerce.OrderSortDirectionDesc,
+		Direction: bigcommerce.OrderSortDirectionAsc,
+	}
+
+	// each status is capped on its own so that, once merged, the lowest
+	// maxOrders IDs across all statuses are all present
+	var orders []bigcommerce.Order
+	for _, statusID := range statusIDs {
+		fetched := 0
+		for page := 1; fetched < maxOrders; page++ {
+			orderQueryParams := bigcommerce.OrderQueryParams{
+				Page:     page,
+				Limit:    ordersPageLimit,
+				Sort:     orderSortParams.String(),
+				MinID:    minOrderID,
+				StatusID: statusID,
+			}
+
+			batch, err := source.GetOrders(orderQueryParams)
+			if err != nil {
+				return nil, fmt.Errorf("[ERROR] getting orders page %d for status %d: %v", page, statusID, err)
+			}
+			orders = append(orders, batch...)
+			fetched += len(batch)
+			if len(batch) < ordersPageLimit {
+				break
+			}
+		}
+	}
+
+	slices.SortFunc(orders, func(a, b bigcommerce.Order) int { return a.ID - b.ID })
+	if len(orders) > maxOrders {
+		log.Printf("[WARNING] order cap of %d reached, later orders will be fetched on the next run", maxOrders)
+		orders = orders[:maxOrders]
+	}
+	return orders, nil
+}
+
+// fetchModifiedOrders gets every order, whatever its status, modified since the
+// given time, oldest change first.
+func fetchModifiedOrders(source OrderSource, since time.Time) ([]bigcommerce.Order, error) {
+	orderSortParams := bigcommerce.OrderSortQuery{
+		Field:     bigcommerce.OrderSortFieldDateModified,
+		Direction: bigcommerce.OrderSortDirectionAsc,
+	}
+
+	var orders []bigcommerce.Order
+	for page := 1; ; page++ {
+		batch, err := source.GetOrders(bigcommerce.OrderQueryParams{
+			Page:            page,
+			Limit:           ordersPageLimit,
+			Sort:            orderSortParams.String(),
+			MinDateModified: since.UTC().Format(time.RFC1123Z),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[ERROR] getting orders modified since %s: %v", since.Format(time.RFC3339), err)
+		}
+		orders = append(orders, batch...)
+		if len(batch) < ordersPageLimit {
+			break
+		}
+	}
+
+	slices.SortStableFunc(orders, func(a, b bigcommerce.Order) int {
+		return parseOrderTime(a.DateModified).Compare(parseOrderTime(b.DateModified))
+	})
+	return orders, nil
+}
+
+// lateOrders picks out the modified orders that are behind the cursor but have
+// only now reached an export status, e.g. a payment that cleared after later
+// orders were exported.
+func lateOrders(db *sql.DB, website string, modified []bigcommerce.Order, minOrderID int, statusIDs []int) ([]bigcommerce.Order, error) {
+	var late []bigcommerce.Order
+	for _, order := range modified {
+		if order.ID >= minOrderID || !slices.Contains(statusIDs, order.StatusID) {
+			continue
+		}
+		exported, err := orderExported(db, order.ID, website)
+		if err != nil {
+			return nil, err
+		}
+		if !exported {
+			late = append(late, order)
+		}
+	}
+	return late, nil
+}
+
+// GenerateOptions changes how GenerateFiles treats the orders it fetches.
+type GenerateOptions struct {
+	// Force regenerates orders that already have a file. The previous file
+	// is kept in order_file_history.
+	Force bool
+	// OrderIDs exports just these orders instead of every new order.
+	OrderIDs []int
+	// DryRun writes each order's file, and a diff against any file already
+	// written for it, to Output instead of exporting it.
+	DryRun bool
+	Output io.Writer
+	// Source, if set, reads each store's orders instead of its API, e.g. a
+	// MemoryOrderSource of captured orders.
+	Source func(store StoreConfig) OrderSource
+}
+
+// GenerateFiles exports new orders for every configured store. A failure in
+// one store does not stop the others.
+func GenerateFiles(db *sql.DB, config Config, opts GenerateOptions) error {
+	var errs []error
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+
+	for _, store := range config.Stores {
+		if err := generateStoreFiles(db, store, opts); err != nil {
+			log.Printf("[ERROR] generating files for %s: %v", store.Website, err)
+			errs = append(errs, fmt.Errorf("%s: %w", store.Website, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func generateStoreFiles(db *sql.DB, store StoreConfig, opts GenerateOptions) error {
+	source := NewOrderSource(store)
+	if opts.Source != nil {
+		source = opts.Source(store)
+	}
+	statusIDs, err := exportStatusIDs(source, store)
+	if err != nil {
+		return err
+	}
+	if store, err = resolveWriteBack(source, store); err != nil {
+		return err
+	}
+
+	if !opts.DryRun {
+		if err := removeStaleTempFiles(store.OutputDir); err != nil {
+			log.Printf("[WARNING] cleaning up temp files in %s: %v", store.OutputDir, err)
+		}
 	}
 
-	orderQueryParams := bigcommerce.OrderQueryParams{
-		Limit:    10,
-		Sort:     orderSortParams.String(),
-		MinID:    config.MinOrderID,
-		StatusID: statusID,
+	if len(opts.OrderIDs) > 0 {
+		return generateSelectedFiles(db, source, store, statusIDs, opts)
 	}
 
-	orders, _, err := client.V2.GetOrders(orderQueryParams)
+	runStart := time.Now()
+	cursor, _, err := GetSyncCursor(db, store.Website)
 	if err != nil {
-		return fmt.Errorf("[ERROR] getting orders: %v", err)
+		return err
 	}
+	minOrderID, err := startOrderID(db, store)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s starting from order %d", store.Website, minOrderID)
 
-	stmt, err := db.Prepare(`INSERT INTO orders(order_id, xml_file_created, website) VALUES (?, ?, ?)`)
+	orders, err := fetchOrders(source, minOrderID, statusIDs, store.MaxOrders)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
 
+	// the first run has nothing to compare with, so it only records when it
+	// started
+	var modified []bigcommerce.Order
+	if !cursor.LastModified.IsZero() {
+		if modified, err = fetchModifiedOrders(source, cursor.LastModified); err != nil {
+			return err
+		}
+		late, err := lateOrders(db, store.Website, modified, minOrderID, statusIDs)
+		if err != nil {
+			return err
+		}
+		if len(late) > 0 {
+			log.Printf("%s: %d older orders have reached an export status", store.Website, len(late))
+			orders = append(late, orders...)
+		}
+	}
+
+	summary := runSummary{fetched: len(orders)}
+	defer func() {
+		log.Printf("%s: fetched %d, converted %d, skipped %d, failed %d", store.Website, summary.fetched, summary.converted, summary.skipped, summary.failed)
+	}()
+
+	// in batch mode orders are written, and the cursor moved past them, when
+	// their batch file is
+	var batch *orderBatch
+	if store.Batch.Enabled && !opts.DryRun {
+		batch = newOrderBatch(db, source, store)
+	}
+	// batched orders are counted when their file is written, as every order
+	// in a file that fails is journalled as failed
+	flushBatch := func() error {
+		n := len(batch.pending)
+		err := batch.flush()
+		for range n {
+			summary.count(err)
+		}
+		return err
+	}
+	addToBatch := func(order bigcommerce.Order, replace, advanceCursor bool) error {
+		if err := batch.add(order, replace, advanceCursor); err != nil {
+			summary.count(err)
+			return err
+		}
+		if !batch.full() {
+			return nil
+		}
+		return flushBatch()
+	}
+
+	fetched := map[int]bool{}
 	for _, order := range orders {
-		xml, err := orderToXML(client, config.JobType, order)
+		fetched[order.ID] = true
+
+		if opts.DryRun {
+			if err := previewOrder(opts.Output, db, source, store, order); err != nil {
+				summary.failed++
+				continue
+			}
+			summary.converted++
+			continue
+		}
+
+		exported, err := orderExported(db, order.ID, store.Website)
+		if err != nil {
+			return err
+		}
+		if exported && !opts.Force {
+			summary.skipped++
+			if batch != nil {
+				err = batch.skip(order)
+			} else {
+				err = AdvanceSyncCursor(db, store.Website, order.ID)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		quarantined, err := awaitingReview(db, store.Website, order.ID)
 		if err != nil {
+			return err
+		}
+		if quarantined {
+			summary.skipped++
+			continue
+		}
+
+		if batch != nil {
+			err = addToBatch(order, exported, true)
+		} else {
+			err = processOrder(db, source, store, order, exported)
+			summary.count(err)
+		}
+		if err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			log.Printf("[ERROR]  %v\n", err)
+			continue
+		}
+		if batch != nil {
+			continue
+		}
+
+		if err := AdvanceSyncCursor(db, store.Website, order.ID); err != nil {
+			return err
+		}
+	}
+
+	if opts.DryRun {
+		if summary.failed > 0 {
+			return fmt.Errorf("%d of %d orders could not be converted", summary.failed, summary.fetched)
+		}
+		return nil
+	}
+
+	// orders that failed on an earlier run are behind the cursor, so fetch
+	// them individually
+	failed, err := FailedOrders(db, store.Website)
+	if err != nil {
+		return err
+	}
+	for _, f := range failed {
+		if fetched[f.OrderID] {
+			continue
+		}
+		summary.fetched++
+
+		order, err := source.GetOrder(f.OrderID)
+		if err != nil {
+			err = attemptError(OutcomeFetchFailed, "error getting order %d: %v", f.OrderID, err)
+			if rerr := RecordAttempt(db, store.Website, f.OrderID, err); rerr != nil {
+				return rerr
+			}
+			summary.failed++
 			log.Printf("[ERROR]  %v\n", err)
 			continue
 		}
 
-		fileName := fileDestination + "order" + strconv.Itoa(order.ID) + ".xml"
-		err = xmlToFile(fileName, xml)
+		if !slices.Contains(statusIDs, order.StatusID) {
+			summary.skipped++
+			log.Printf("[WARNING] not retrying order %d, its status is now %s", order.ID, order.Status)
+			continue
+		}
+
+		if batch != nil {
+			err = addToBatch(order, false, false)
+		} else {
+			err = processOrder(db, source, store, order, false)
+			summary.count(err)
+		}
+		if err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			log.Printf("[ERROR] retrying %v\n", err)
+		}
+	}
+
+	if batch != nil {
+		if err := flushBatch(); err != nil {
+			return err
+		}
+	}
+
+	// late orders that failed are journalled and retried with the others, so
+	// only a failed change holds last_modified back
+	lastModified := runStart
+	if !cursor.LastModified.IsZero() {
+		lastModified, err = syncOrderChanges(db, source, store, modified, fetched, cursor.LastModified)
+		if err != nil {
+			log.Printf("[ERROR] checking %s for changed orders: %v", store.Website, err)
+		}
+	}
+	if err := AdvanceSyncCursor(db, store.Website, minOrderID-1); err != nil {
+		return err
+	}
+	return advanceLastModified(db, store.Website, lastModified)
+}
+
+// generateSelectedFiles exports, or previews, just the orders in opts.OrderIDs.
+// The sync cursor is left where it is.
+func generateSelectedFiles(db *sql.DB, source OrderSource, store StoreConfig, statusIDs []int, opts GenerateOptions) error {
+	// failed previews are returned, as nothing is journalled in a dry run
+	var previewErrs []error
+	for _, orderID := range opts.OrderIDs {
+		order, err := source.GetOrder(orderID)
 		if err != nil {
-			return fmt.Errorf("[ERROR] %v", err)
+			log.Printf("[ERROR] getting %s order %d: %v", store.Website, orderID, err)
+			if opts.DryRun {
+				previewErrs = append(previewErrs, fmt.Errorf("getting order %d: %w", orderID, err))
+			}
+			continue
+		}
+
+		if opts.DryRun {
+			if !slices.Contains(statusIDs, order.StatusID) {
+				fmt.Fprintf(opts.Output, "# note: order %d is %s, so it would not be exported\n", order.ID, order.Status)
+			}
+			if err := previewOrder(opts.Output, db, source, store, order); err != nil {
+				previewErrs = append(previewErrs, err)
+			}
+			continue
 		}
 
-		_, err = stmt.Exec(order.ID, time.Now().UTC(), jobTypeToWebsiteName(config.JobType))
+		if !slices.Contains(statusIDs, order.StatusID) {
+			log.Printf("[WARNING] skipping order %d, its status is %s", order.ID, order.Status)
+			continue
+		}
+
+		exported, err := orderExported(db, order.ID, store.Website)
 		if err != nil {
 			return err
 		}
+		if exported && !opts.Force {
+			log.Printf("[WARNING] skipping order %d, it has already been exported. Use --force to regenerate it", order.ID)
+			continue
+		}
+
+		if err := processOrder(db, source, store, order, exported); err != nil {
+			if !isRetryable(err) {
+				return err
+			}
+			log.Printf("[ERROR]  %v\n", err)
+			continue
+		}
+		log.Printf("exported %s order %d", store.Website, order.ID)
+	}
+	return errors.Join(previewErrs...)
+}
+
+// previewOrder writes the file an order would be exported as to w, followed by
+// a diff against the file already written for it, if there is one.
+func previewOrder(w io.Writer, db *sql.DB, source OrderSource, store StoreConfig, order bigcommerce.Order) error {
+	fileName := orderFileName(store, order.ID)
+	fmt.Fprintf(w, "==> %s order %d (%s)\n", store.Website, order.ID, fileName)
+
+	doc, warnings, err := encodeOrder(source, newEncoder(store.Format), newConverter(store), dateSources(db, source, store), order)
+	if err != nil {
+		fmt.Fprintf(w, "# error: %v\n\n", err)
+		return err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "# warning: %s\n", warning)
+	}
+	if len(warnings) > 0 && (store.WarningPolicy == WarningPolicyBlock || store.WarningPolicy == WarningPolicyQuarantine) {
+		fmt.Fprintf(w, "# note: the %s warning policy would stop this file being written\n", store.WarningPolicy)
+	}
+	fmt.Fprintf(w, "%s\n", doc)
 
+	existing, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(w, "# no existing file\n\n")
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintf(w, "# error reading existing file: %v\n\n", err)
+		return nil
+	}
+
+	if diff := unifiedDiff(fileName, "preview", existing, doc); diff != "" {
+		fmt.Fprintf(w, "%s\n", diff)
+	} else {
+		fmt.Fprintf(w, "# identical to existing file\n\n")
 	}
 	return nil
 }
+
+// isRetryable reports whether a failure only affects the order being exported,
+// so the run can carry on with the next one.
+func isRetryable(err error) bool {
+	var attemptErr *AttemptError
+	return errors.As(err, &attemptErr) && attemptErr.Outcome != OutcomeWriteFailed
+}
+
+// refused reports whether err was tagged as a validation failure, e.g. a
+// document the sink rejected. Untagged errors, such as a database error after
+// the document was sent, are not.
+func refused(err error) bool {
+	var attemptErr *AttemptError
+	return errors.As(err, &attemptErr) && attemptErr.Outcome == OutcomeValidationFailed
+}
+
+// processOrder exports an order and journals the attempt. replace regenerates
+// the file for an order that has already been exported.
+func processOrder(db *sql.DB, source OrderSource, store StoreConfig, order bigcommerce.Order, replace bool) error {
+	return recordOutcome(db, store.Website, order.ID, exportOrder(db, source, store, order, replace))
+}
+
+// recordOutcome journals the result of an attempt to export an order and
+// returns err.
+func recordOutcome(db *sql.DB, website string, orderID int, err error) error {
+	var attemptErr *AttemptError
+	if err != nil && !errors.As(err, &attemptErr) {
+		// database errors are not about the order itself
+		return err
+	}
+	if rerr := RecordAttempt(db, website, orderID, err); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	return err
+}
+
+func exportOrder(db *sql.DB, source OrderSource, store StoreConfig, order bigcommerce.Order, replace bool) error {
+	bundle, hireJob, err := prepareOrder(db, source, store, order)
+	if err != nil {
+		return err
+	}
+
+	fileName, err := writeOrderFile(db, store, order.ID, hireJob, replace)
+	if refused(err) {
+		// the hire system refused it, and would again
+		return holdForReview(db, store.Website, bundle, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeBack(source, store, order, fileName, time.Now()); err != nil {
+		log.Printf("[ERROR] order %d was exported but could not be updated in BigCommerce: %v", order.ID, err)
+	}
+	return nil
+}
+
+// prepareOrder converts an order that is ready to be written, quarantining it
+// or applying the store's warning policy if it is not. The bundle is returned
+// so the order can still be quarantined if the sink refuses it.
+func prepareOrder(db *sql.DB, source OrderSource, store StoreConfig, order bigcommerce.Order) (OrderBundle, Order, error) {
+	bundle, err := fetchOrderBundle(source, dateSources(db, source, store), order)
+	if err != nil {
+		return OrderBundle{}, Order{}, err
+	}
+
+	hireJob, warnings, err := newConverter(store).Convert(bundle)
+	if outcomeOf(err) == OutcomeValidationFailed {
+		return OrderBundle{}, Order{}, holdForReview(db, store.Website, bundle, err)
+	}
+	if err != nil {
+		return OrderBundle{}, Order{}, err
+	}
+
+	if err := applyWarningPolicy(db, store, bundle, warnings); err != nil {
+		return OrderBundle{}, Order{}, err
+	}
+	return bundle, hireJob, nil
+}
+
+// holdForReview quarantines an order that failed validation, as retrying will
+// not fix it, with the failure as the reason for staff to correct.
+func holdForReview(db *sql.DB, website string, bundle OrderBundle, err error) error {
+	if qerr := QuarantineOrder(db, website, bundle, err.Error(), nil); qerr != nil {
+		return qerr
+	}
+	return attemptError(OutcomeQuarantined, "order %d %w: %v", bundle.Order.ID, ErrQuarantined, err)
+}
+
+// writeOrderFile sends an order to the store's sink and records it in the
+// orders table, returning where it went.
+func writeOrderFile(db *sql.DB, store StoreConfig, orderID int, hireJob Order, replace bool) (string, error) {
+	hash, err := hireJobHash(hireJob)
+	if err != nil {
+		return "", attemptError(OutcomeValidationFailed, "order %d: %v", orderID, err)
+	}
+
+	sink := newSink(store)
+	var previous []byte
+	if replace && sink.Watched() {
+		var err error
+		if previous, err = previousFile(db, store.Website, orderID); err != nil {
+			return "", attemptError(OutcomeWriteFailed, "reading previous file for order %d: %v", orderID, err)
+		}
+	}
+
+	fileName, err := sendOrders(store, sink, orderDocumentName(orderID), []Order{hireJob}, nil)
+	if err != nil {
+		var attemptErr *AttemptError
+		if errors.As(err, &attemptErr) {
+			return "", err
+		}
+		return "", &AttemptError{Outcome: OutcomeWriteFailed, Err: err}
+	}
+
+	if replace {
+		err = ReplaceFileCreation(db, orderID, store.Website, fileName, previous)
+	} else {
+		err = SaveFileCreation(db, orderID, store.Website, fileName)
+	}
+	if errors.Is(err, ErrAlreadyExported) {
+		log.Printf("[WARNING] order %d was exported by another process during this run", orderID)
+		return fileName, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := setContentHash(db, store.Website, orderID, hash); err != nil {
+		return "", err
+	}
+	if !sink.Watched() {
+		if err := markSent(db, store.Website, orderID); err != nil {
+			return "", err
+		}
+	}
+	return fileName, nil
+}
+
+// previousFile reads the file last recorded for an order, or nil if there is
+// none or it has gone.
+func previousFile(db *sql.DB, website string, orderID int) ([]byte, error) {
+	exported, ok, err := getExportedOrder(db, website, orderID)
+	if err != nil || !ok || exported.FilePath == "" {
+		return nil, err
+	}
+	previous, err := os.ReadFile(exported.FilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return previous, err
+}
+
+// GenerateFile exports a single order as soon as it is known about, e.g. from a
+// webhook. It returns ErrOrderNotReady if the order is not in one of the
+// store's export statuses, ErrAlreadyExported if a file has already been
+// written for it and an error wrapping ErrQuarantined if it was held back for
+// review.
+func GenerateFile(db *sql.DB, store StoreConfig, orderID int) error {
+	exported, err := orderExported(db, orderID, store.Website)
+	if err != nil {
+		return err
+	}
+	if exported {
+		return ErrAlreadyExported
+	}
+
+	source := NewOrderSource(store)
+	order, err := source.GetOrder(orderID)
+	if err != nil {
+		return fmt.Errorf("[ERROR] getting order %d: %v", orderID, err)
+	}
+
+	statusIDs, err := exportStatusIDs(source, store)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(statusIDs, order.StatusID) {
+		return ErrOrderNotReady
+	}
+	if store, err = resolveWriteBack(source, store); err != nil {
+		return err
+	}
+
+	return processOrder(db, source, store, order, false)
+}
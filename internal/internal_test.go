@@ -9,15 +9,18 @@ import (
 	"github.com/seanomeara96/go-bigcommerce"
 )
 
+// TestGetOrder runs against the live CaterHire store, so it is skipped unless
+// credentials are available. TestGenerateFilesEndToEnd covers the same calls
+// against the fake store.
 func TestGetOrder(t *testing.T) {
 	if err := godotenv.Load("../../.env"); err != nil {
-		t.Fatalf("[ERROR] loading .env file: %v", err)
+		t.Skipf("loading .env file: %v", err)
 	}
 
 	storeHash := os.Getenv("CH_STORE_HASH")
 	authToken := os.Getenv("CH_XAUTHTOKEN")
 	if storeHash == "" || authToken == "" {
-		t.Fatalf("[ERROR] missing environment variables CH_STORE_HASH or CH_XAUTHTOKEN")
+		t.Skip("missing environment variables CH_STORE_HASH or CH_XAUTHTOKEN")
 	}
 
 	client := bigcommerce.NewClient(storeHash, authToken, nil, log.Default())
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Outcome is the result of one attempt at exporting an order.
+type Outcome string
+
+const (
+	OutcomeSuccess          Outcome = "success"
+	OutcomeValidationFailed Outcome = "validation_failed"
+	OutcomeFetchFailed      Outcome = "fetch_failed"
+	OutcomeDateParseFailed  Outcome = "date_parse_failed"
+	OutcomeWriteFailed      Outcome = "write_failed"
+	OutcomeBlocked          Outcome = "blocked"
+	OutcomeQuarantined      Outcome = "quarantined"
+
+	// OutcomeSendFailed is a remote sink that could not be reached or had a
+	// server error. Unlike a local write failure it does not stop the run.
+	OutcomeSendFailed Outcome = "send_failed"
+)
+
+// AttemptError is an export failure tagged with the outcome it is journalled
+// under.
+type AttemptError struct {
+	Outcome Outcome
+	Err     error
+}
+
+func (e *AttemptError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AttemptError) Unwrap() error {
+	return e.Err
+}
+
+func attemptError(outcome Outcome, format string, a ...any) error {
+	return &AttemptError{Outcome: outcome, Err: fmt.Errorf(format, a...)}
+}
+
+// outcomeOf classifies err for the journal. Errors that were not tagged with
+// an outcome are treated as validation failures.
+func outcomeOf(err error) Outcome {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	var attemptErr *AttemptError
+	if errors.As(err, &attemptErr) {
+		return attemptErr.Outcome
+	}
+	return OutcomeValidationFailed
+}
+
+// Attempt is one journalled export attempt.
+type Attempt struct {
+	Website     string
+	OrderID     int
+	Outcome     Outcome
+	Error       string
+	AttemptedAt time.Time
+}
+
+// RecordAttempt journals the outcome of exporting an order. err is nil for a
+// successful attempt.
+func RecordAttempt(db *sql.DB, website string, orderID int, err error) error {
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	if _, err := db.Exec(`INSERT INTO order_attempts(order_id, website, outcome, error, attempted_at) VALUES(?, ?, ?, ?, ?)`,
+		orderID, website, outcomeOf(err), message, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error recording attempt for order %d: %w", orderID, err)
+	}
+	return nil
+}
+
+// OrderAttempts returns every attempt at exporting an order, oldest first.
+func OrderAttempts(db *sql.DB, website string, orderID int) ([]Attempt, error) {
+	rows, err := db.Query(`SELECT website, order_id, outcome, error, attempted_at FROM order_attempts WHERE website = ? AND order_id = ? ORDER BY id`, website, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		if err := rows.Scan(&a.Website, &a.OrderID, &a.Outcome, &a.Error, &a.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// FailedOrder is an order whose latest attempt failed and that has not since
+// been exported, ignored or quarantined. Released orders are retried.
+type FailedOrder struct {
+	Attempt
+	Attempts int
+}
+
+// FailedOrders lists the orders still waiting to be retried. An empty website
+// lists them for every store.
+func FailedOrders(db *sql.DB, website string) ([]FailedOrder, error) {
+	rows, err := db.Query(`
+	SELECT a.website, a.order_id, a.outcome, a.error, a.attempted_at,
+		(SELECT COUNT(*) FROM order_attempts c WHERE c.website = a.website AND c.order_id = a.order_id)
+	FROM order_attempts a
+	WHERE a.id = (SELECT MAX(b.id) FROM order_attempts b WHERE b.website = a.website AND b.order_id = a.order_id)
+		AND a.outcome != ?
+		AND (? = '' OR a.website = ?)
+		AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.website = a.website AND o.order_id = a.order_id)
+		AND NOT EXISTS (SELECT 1 FROM ignored_orders i WHERE i.website = a.website AND i.order_id = a.order_id)
+		AND NOT EXISTS (SELECT 1 FROM quarantined_orders q WHERE q.website = a.website AND q.order_id = a.order_id AND q.released_at IS NULL)
+	ORDER BY a.website, a.order_id`, OutcomeSuccess, website, website)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failed []FailedOrder
+	for rows.Next() {
+		var f FailedOrder
+		if err := rows.Scan(&f.Website, &f.OrderID, &f.Outcome, &f.Error, &f.AttemptedAt, &f.Attempts); err != nil {
+			return nil, err
+		}
+		failed = append(failed, f)
+	}
+	return failed, rows.Err()
+}
+
+// IgnoreOrder stops a failed order from being retried.
+func IgnoreOrder(db *sql.DB, website string, orderID int, reason string) error {
+	_, err := db.Exec(`
+	INSERT INTO ignored_orders(website, order_id, reason, ignored_at) VALUES(?, ?, ?, ?)
+	ON CONFLICT(website, order_id) DO UPDATE SET reason = excluded.reason, ignored_at = excluded.ignored_at`,
+		website, orderID, reason, time.Now().UTC())
+	return err
+}
+
+// UnignoreOrder lets an ignored order be retried again.
+func UnignoreOrder(db *sql.DB, website string, orderID int) error {
+	_, err := db.Exec(`DELETE FROM ignored_orders WHERE website = ? AND order_id = ?`, website, orderID)
+	return err
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestFailedOrders(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := Database(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dateErr := attemptError(OutcomeDateParseFailed, "could not extract dates")
+	fetchErr := attemptError(OutcomeFetchFailed, "timeout")
+
+	// 1 keeps failing, 2 fails then succeeds, 3 fails and is ignored,
+	// 4 fails and is later exported by a webhook
+	for _, a := range []struct {
+		orderID int
+		err     error
+	}{
+		{1, dateErr}, {1, fetchErr},
+		{2, fetchErr}, {2, nil},
+		{3, dateErr},
+		{4, fetchErr},
+	} {
+		if err := RecordAttempt(db, "caterhire", a.orderID, a.err); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := IgnoreOrder(db, "caterhire", 3, "customer will phone in dates"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveFileCreation(db, 4, "caterhire", "order4.xml"); err != nil {
+		t.Fatal(err)
+	}
+
+	failed, err := FailedOrders(db, "caterhire")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 {
+		t.Fatalf("expected only order 1 to be waiting for a retry, got %+v", failed)
+	}
+	if failed[0].OrderID != 1 || failed[0].Outcome != OutcomeFetchFailed || failed[0].Attempts != 2 {
+		t.Errorf("unexpected failed order %+v", failed[0])
+	}
+
+	if err := UnignoreOrder(db, "caterhire", 3); err != nil {
+		t.Fatal(err)
+	}
+	failed, err = FailedOrders(db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 2 {
+		t.Errorf("expected unignored order 3 to be retried, got %+v", failed)
+	}
+}
+
+func TestOutcomeOf(t *testing.T) {
+	wrapped := errors.Join(errors.New("context"), attemptError(OutcomeDateParseFailed, "bad date"))
+	if got := outcomeOf(wrapped); got != OutcomeDateParseFailed {
+		t.Errorf("expected %s, got %s", OutcomeDateParseFailed, got)
+	}
+	if got := outcomeOf(nil); got != OutcomeSuccess {
+		t.Errorf("expected %s, got %s", OutcomeSuccess, got)
+	}
+}
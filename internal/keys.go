@@ -1,6 +0,0 @@
-package internal
-
-type website string
-
-const CATERHIRE website = "caterhire"
-const HIREALL website = "hireall"
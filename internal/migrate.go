@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change, read from
+// migrations/NNNN_name.up.sql and its matching .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied to a database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		matches := migrationFileName.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("unexpected migration file name %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	if _, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations(
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// pendingMigrations counts the migrations not yet applied to db. Unlike
+// appliedMigrations it does not create schema_migrations, so it works on a
+// read-only database.
+func pendingMigrations(db *sql.DB) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	var tracked bool
+	if err := db.QueryRow(`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&tracked); err != nil {
+		return 0, err
+	}
+	if !tracked {
+		return len(migrations), nil
+	}
+
+	rows, err := db.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// MigrationStatuses lists every known migration and whether it has been
+// applied, oldest first.
+func MigrationStatuses(db *sql.DB) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// MigrateUp applies up to steps pending migrations, or all of them if steps is
+// 0, and returns the ones it applied.
+func MigrateUp(db *sql.DB, steps int) ([]Migration, error) {
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, s := range statuses {
+		if s.Applied {
+			continue
+		}
+		if steps > 0 && len(done) == steps {
+			break
+		}
+
+		if err := runMigration(db, s.Migration.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)`, s.Version, s.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return done, fmt.Errorf("error applying migration %d_%s: %w", s.Version, s.Name, err)
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the steps most recently applied migrations and returns
+// the ones it reverted.
+func MigrateDown(db *sql.DB, steps int) ([]Migration, error) {
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(statuses)
+
+	var done []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			continue
+		}
+		if len(done) == steps {
+			break
+		}
+
+		if err := runMigration(db, s.Migration.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, s.Version)
+			return err
+		}); err != nil {
+			return done, fmt.Errorf("error reverting migration %d_%s: %w", s.Version, s.Name, err)
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+func runMigration(db *sql.DB, query string, record func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateRoundTrip(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDatabase(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := MigrateUp(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrations), len(done))
+	}
+
+	done, err = MigrateDown(db, len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != len(migrations) {
+		t.Fatalf("expected %d migrations reverted, got %d", len(migrations), len(done))
+	}
+
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatalf("re-applying migrations after reverting them: %v", err)
+	}
+
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %d_%s not applied", s.Version, s.Name)
+		}
+	}
+}
+
+// Databases created before migrations existed already have an orders table,
+// possibly with duplicate rows, and no schema_migrations table.
+func TestMigrateLegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	db, err := OpenDatabase(&dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+	CREATE TABLE orders(
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		xml_file_created DATETIME NOT NULL,
+		website TEXT NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec(`INSERT INTO orders(order_id, xml_file_created, website) VALUES(4126, ?, 'caterhire')`, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := MigrateUp(db, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM orders WHERE order_id = 4126`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected duplicate orders to be removed, got %d rows", count)
+	}
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS orders(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	xml_file_created DATETIME NOT NULL,
+	website TEXT NOT NULL
+);
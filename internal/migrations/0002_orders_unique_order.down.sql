@@ -0,0 +1 @@
+DROP INDEX orders_website_order_id;
@@ -0,0 +1,6 @@
+-- earlier runs could record the same order more than once, keep the first
+DELETE FROM orders WHERE id NOT IN (
+	SELECT MIN(id) FROM orders GROUP BY website, order_id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS orders_website_order_id ON orders(website, order_id);
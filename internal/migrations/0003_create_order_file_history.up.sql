@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS order_file_history(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	website TEXT NOT NULL,
+	xml_file_created DATETIME NOT NULL,
+	replaced_at DATETIME NOT NULL,
+	contents BLOB
+);
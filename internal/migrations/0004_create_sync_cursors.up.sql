@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS sync_cursors(
+	website TEXT PRIMARY KEY,
+	last_order_id INTEGER NOT NULL,
+	last_modified DATETIME,
+	updated_at DATETIME NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE order_file_history DROP COLUMN file_path;
+ALTER TABLE orders DROP COLUMN file_path;
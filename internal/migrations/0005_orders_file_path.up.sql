@@ -0,0 +1,2 @@
+ALTER TABLE orders ADD COLUMN file_path TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_file_history ADD COLUMN file_path TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE ignored_orders;
+DROP TABLE order_attempts;
@@ -0,0 +1,18 @@
+CREATE TABLE order_attempts(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	website TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	error TEXT NOT NULL DEFAULT '',
+	attempted_at DATETIME NOT NULL
+);
+
+CREATE INDEX order_attempts_website_order_id ON order_attempts(website, order_id);
+
+CREATE TABLE ignored_orders(
+	website TEXT NOT NULL,
+	order_id INTEGER NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	ignored_at DATETIME NOT NULL,
+	PRIMARY KEY(website, order_id)
+);
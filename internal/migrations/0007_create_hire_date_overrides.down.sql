@@ -0,0 +1 @@
+DROP TABLE hire_date_overrides;
@@ -0,0 +1,9 @@
+CREATE TABLE hire_date_overrides(
+	website TEXT NOT NULL,
+	order_id INTEGER NOT NULL,
+	delivery_date TEXT NOT NULL,
+	collection_date TEXT NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	PRIMARY KEY(website, order_id)
+);
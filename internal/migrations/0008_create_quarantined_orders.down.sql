@@ -0,0 +1 @@
+DROP TABLE quarantined_orders;
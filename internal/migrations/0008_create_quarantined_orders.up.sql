@@ -0,0 +1,8 @@
+CREATE TABLE quarantined_orders(
+	website TEXT NOT NULL,
+	order_id INTEGER NOT NULL,
+	warnings TEXT NOT NULL DEFAULT '[]',
+	quarantined_at DATETIME NOT NULL,
+	released_at DATETIME,
+	PRIMARY KEY(website, order_id)
+);
@@ -0,0 +1,8 @@
+ALTER TABLE quarantined_orders DROP COLUMN delivery_type;
+ALTER TABLE quarantined_orders DROP COLUMN delivery_instructions;
+ALTER TABLE quarantined_orders DROP COLUMN collection_date;
+ALTER TABLE quarantined_orders DROP COLUMN delivery_date;
+ALTER TABLE quarantined_orders DROP COLUMN shipping_addresses_json;
+ALTER TABLE quarantined_orders DROP COLUMN products_json;
+ALTER TABLE quarantined_orders DROP COLUMN order_json;
+ALTER TABLE quarantined_orders DROP COLUMN reason;
@@ -0,0 +1,8 @@
+ALTER TABLE quarantined_orders ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE quarantined_orders ADD COLUMN order_json TEXT NOT NULL DEFAULT '';
+ALTER TABLE quarantined_orders ADD COLUMN products_json TEXT NOT NULL DEFAULT '';
+ALTER TABLE quarantined_orders ADD COLUMN shipping_addresses_json TEXT NOT NULL DEFAULT '';
+ALTER TABLE quarantined_orders ADD COLUMN delivery_date TEXT;
+ALTER TABLE quarantined_orders ADD COLUMN collection_date TEXT;
+ALTER TABLE quarantined_orders ADD COLUMN delivery_instructions TEXT;
+ALTER TABLE quarantined_orders ADD COLUMN delivery_type INTEGER;
@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN alerted_at;
+ALTER TABLE orders DROP COLUMN consumed_via;
+ALTER TABLE orders DROP COLUMN consumed_at;
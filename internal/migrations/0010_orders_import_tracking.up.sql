@@ -0,0 +1,3 @@
+ALTER TABLE orders ADD COLUMN consumed_at DATETIME;
+ALTER TABLE orders ADD COLUMN consumed_via TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN alerted_at DATETIME;
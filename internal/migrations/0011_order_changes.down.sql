@@ -0,0 +1,3 @@
+ALTER TABLE orders DROP COLUMN cancelled_at;
+ALTER TABLE orders DROP COLUMN revision;
+ALTER TABLE orders DROP COLUMN content_hash;
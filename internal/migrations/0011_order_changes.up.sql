@@ -0,0 +1,3 @@
+ALTER TABLE orders ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN cancelled_at DATETIME;
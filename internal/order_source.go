@@ -0,0 +1,250 @@
+package internal
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// OrderSource is where orders, and the details needed to convert them, are
+// read from, and where exported orders are written back to. A request with no
+// results returns an empty list rather than an error.
+type OrderSource interface {
+	GetOrder(orderID int) (bigcommerce.Order, error)
+	GetOrders(params bigcommerce.OrderQueryParams) ([]bigcommerce.Order, error)
+	GetOrderProducts(orderID int, params bigcommerce.OrderProductsQueryParams) ([]bigcommerce.OrderProduct, error)
+	GetOrderShippingAddresses(orderID int) ([]bigcommerce.ShippingAddress, error)
+	GetOrderStatuses() ([]bigcommerce.OrderStatus, error)
+	// GetOrderMetafields returns an order's metafields in one namespace.
+	GetOrderMetafields(orderID int, namespace string) ([]OrderMetafield, error)
+
+	UpdateOrder(orderID int, update OrderUpdate) error
+	// SetOrderMetafield creates the metafield, or updates the one with the
+	// same namespace and key.
+	SetOrderMetafield(orderID int, metafield OrderMetafield) error
+}
+
+// OrderMetafield is a value an app has stored on an order.
+type OrderMetafield struct {
+	ID        int    `json:"id,omitempty"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	// PermissionSet is required when creating a metafield.
+	PermissionSet string `json:"permission_set,omitempty"`
+}
+
+// OrderUpdate changes the fields of an order that are set.
+type OrderUpdate struct {
+	StatusID   *int    `json:"status_id,omitempty"`
+	StaffNotes *string `json:"staff_notes,omitempty"`
+}
+
+// bigCommerceSource reads orders from a store's V2 API, and metafields from
+// its V3 API.
+type bigCommerceSource struct {
+	client *bigcommerce.Client
+}
+
+func newBigCommerceSource(client *bigcommerce.Client) OrderSource {
+	return bigCommerceSource{client: client}
+}
+
+// NewOrderSource connects to a store's API.
+func NewOrderSource(store StoreConfig) OrderSource {
+	return newBigCommerceSource(bigcommerce.NewClient(store.StoreHash, store.AuthToken, nil, nil))
+}
+
+func (s bigCommerceSource) GetOrder(orderID int) (bigcommerce.Order, error) {
+	return s.client.V2.GetOrder(orderID)
+}
+
+// GetOrders returns nil, rather than the client's error, for the empty 204
+// BigCommerce sends once there are no more pages.
+func (s bigCommerceSource) GetOrders(params bigcommerce.OrderQueryParams) ([]bigcommerce.Order, error) {
+	orders, _, err := s.client.V2.GetOrders(params)
+	if isEmptyResponse(err) {
+		return nil, nil
+	}
+	return orders, err
+}
+
+func (s bigCommerceSource) GetOrderProducts(orderID int, params bigcommerce.OrderProductsQueryParams) ([]bigcommerce.OrderProduct, error) {
+	products, _, err := s.client.V2.GetOrderProducts(orderID, params)
+	if isEmptyResponse(err) {
+		return nil, nil
+	}
+	return products, err
+}
+
+func (s bigCommerceSource) GetOrderShippingAddresses(orderID int) ([]bigcommerce.ShippingAddress, error) {
+	addresses, err := s.client.V2.GetOrderShippingAddress(orderID, bigcommerce.ShippingAddressQueryParams{})
+	if isEmptyResponse(err) {
+		return nil, nil
+	}
+	return addresses, err
+}
+
+func (s bigCommerceSource) GetOrderStatuses() ([]bigcommerce.OrderStatus, error) {
+	return s.client.V2.GetOrderStatuses()
+}
+
+// GetOrderMetafields uses the V3 endpoint directly, as the go-bigcommerce
+// client has no call for it.
+func (s bigCommerceSource) GetOrderMetafields(orderID int, namespace string) ([]OrderMetafield, error) {
+	u := s.client.V3.BaseURL().JoinPath("orders", strconv.Itoa(orderID), "metafields")
+	u.RawQuery = url.Values{"namespace": {namespace}, "limit": {"250"}}.Encode()
+
+	var response struct {
+		Data []OrderMetafield `json:"data"`
+	}
+	if err := s.client.V3.Get(u, &response); err != nil {
+		return nil, attemptError(OutcomeFetchFailed, "error getting metafields for order %d: %v", orderID, err)
+	}
+	return response.Data, nil
+}
+
+func (s bigCommerceSource) UpdateOrder(orderID int, update OrderUpdate) error {
+	u := s.client.V2.BaseURL().JoinPath("orders", strconv.Itoa(orderID))
+	if err := s.client.V2.Put(u, update, nil); err != nil {
+		return fmt.Errorf("error updating order %d: %w", orderID, err)
+	}
+	return nil
+}
+
+func (s bigCommerceSource) SetOrderMetafield(orderID int, metafield OrderMetafield) error {
+	metafields, err := s.GetOrderMetafields(orderID, metafield.Namespace)
+	if err != nil {
+		return err
+	}
+
+	u := s.client.V3.BaseURL().JoinPath("orders", strconv.Itoa(orderID), "metafields")
+	for _, m := range metafields {
+		if m.Key == metafield.Key {
+			if err := s.client.V3.Put(u.JoinPath(strconv.Itoa(m.ID)), metafield, nil); err != nil {
+				return fmt.Errorf("error updating metafield %s.%s on order %d: %w", metafield.Namespace, metafield.Key, orderID, err)
+			}
+			return nil
+		}
+	}
+	if err := s.client.V3.Post(u, metafield, nil); err != nil {
+		return fmt.Errorf("error creating metafield %s.%s on order %d: %w", metafield.Namespace, metafield.Key, orderID, err)
+	}
+	return nil
+}
+
+// MemoryOrderSource serves orders held in memory, such as ones captured from a
+// store, so they can be converted without the network. Orders are filtered by
+// the query parameters the exporter uses: min_id, status_id and
+// min_date_modified. Write backs change the orders and metafields in place.
+type MemoryOrderSource struct {
+	Orders []bigcommerce.Order
+	// Products, ShippingAddresses and Metafields are keyed by order ID.
+	Products          map[int][]bigcommerce.OrderProduct
+	ShippingAddresses map[int][]bigcommerce.ShippingAddress
+	Metafields        map[int][]OrderMetafield
+	Statuses          []bigcommerce.OrderStatus
+}
+
+const memorySourcePageLimit = 50
+
+func (s *MemoryOrderSource) GetOrder(orderID int) (bigcommerce.Order, error) {
+	for _, order := range s.Orders {
+		if order.ID == orderID {
+			return order, nil
+		}
+	}
+	return bigcommerce.Order{}, fmt.Errorf("order %d not found", orderID)
+}
+
+func (s *MemoryOrderSource) GetOrders(params bigcommerce.OrderQueryParams) ([]bigcommerce.Order, error) {
+	var modifiedSince time.Time
+	if params.MinDateModified != "" {
+		var err error
+		if modifiedSince, err = time.Parse(time.RFC1123Z, params.MinDateModified); err != nil {
+			return nil, fmt.Errorf("invalid min_date_modified %q: %v", params.MinDateModified, err)
+		}
+	}
+
+	var orders []bigcommerce.Order
+	for _, order := range s.Orders {
+		if order.ID < params.MinID || (params.StatusID != 0 && order.StatusID != params.StatusID) {
+			continue
+		}
+		if !modifiedSince.IsZero() && parseOrderTime(order.DateModified).Before(modifiedSince) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+	slices.SortFunc(orders, func(a, b bigcommerce.Order) int { return a.ID - b.ID })
+	return pageOf(orders, params.Page, params.Limit), nil
+}
+
+func (s *MemoryOrderSource) GetOrderProducts(orderID int, params bigcommerce.OrderProductsQueryParams) ([]bigcommerce.OrderProduct, error) {
+	return pageOf(s.Products[orderID], params.Page, params.Limit), nil
+}
+
+func (s *MemoryOrderSource) GetOrderShippingAddresses(orderID int) ([]bigcommerce.ShippingAddress, error) {
+	return s.ShippingAddresses[orderID], nil
+}
+
+func (s *MemoryOrderSource) GetOrderStatuses() ([]bigcommerce.OrderStatus, error) {
+	return s.Statuses, nil
+}
+
+func (s *MemoryOrderSource) GetOrderMetafields(orderID int, namespace string) ([]OrderMetafield, error) {
+	var metafields []OrderMetafield
+	for _, m := range s.Metafields[orderID] {
+		if m.Namespace == namespace {
+			metafields = append(metafields, m)
+		}
+	}
+	return metafields, nil
+}
+
+func (s *MemoryOrderSource) UpdateOrder(orderID int, update OrderUpdate) error {
+	i := slices.IndexFunc(s.Orders, func(o bigcommerce.Order) bool { return o.ID == orderID })
+	if i < 0 {
+		return fmt.Errorf("order %d not found", orderID)
+	}
+	if update.StatusID != nil {
+		s.Orders[i].StatusID = *update.StatusID
+	}
+	if update.StaffNotes != nil {
+		s.Orders[i].StaffNotes = *update.StaffNotes
+	}
+	return nil
+}
+
+func (s *MemoryOrderSource) SetOrderMetafield(orderID int, metafield OrderMetafield) error {
+	if s.Metafields == nil {
+		s.Metafields = map[int][]OrderMetafield{}
+	}
+	metafields := s.Metafields[orderID]
+	i := slices.IndexFunc(metafields, func(m OrderMetafield) bool {
+		return m.Namespace == metafield.Namespace && m.Key == metafield.Key
+	})
+	if i >= 0 {
+		metafield.ID = metafields[i].ID
+		metafields[i] = metafield
+		return nil
+	}
+	metafield.ID = len(metafields) + 1
+	s.Metafields[orderID] = append(metafields, metafield)
+	return nil
+}
+
+// pageOf returns one page of items, counting pages from 1 as the API does.
+func pageOf[T any](items []T, page, limit int) []T {
+	page, limit = max(page, 1), cmp.Or(limit, memorySourcePageLimit)
+	start := (page - 1) * limit
+	if start >= len(items) {
+		return nil
+	}
+	return items[start:min(start+limit, len(items))]
+}
@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// memorySource loads the fake store's fixtures into a MemoryOrderSource.
+func memorySource(t *testing.T) *MemoryOrderSource {
+	t.Helper()
+	dir := filepath.Join("testdata", "bigcommerce")
+	source := &MemoryOrderSource{}
+	loadFixture(t, dir, "order_statuses.json", &source.Statuses)
+	loadFixture(t, dir, "orders.json", &source.Orders)
+	loadFixture(t, dir, "order_products.json", &source.Products)
+	loadFixture(t, dir, "shipping_addresses.json", &source.ShippingAddresses)
+	return source
+}
+
+var testConverter = Converter{JobType: 1, DeliveryRules: defaultDeliveryRules}
+
+func testProducts(orderID, n int) []bigcommerce.OrderProduct {
+	products := make([]bigcommerce.OrderProduct, n)
+	for i := range products {
+		products[i] = bigcommerce.OrderProduct{
+			ID:         i + 1,
+			OrderID:    orderID,
+			Name:       "Chair " + strconv.Itoa(i+1),
+			SKU:        "CHR-" + strconv.Itoa(i+1),
+			Quantity:   1,
+			BasePrice:  "1.0000",
+			TotalExTax: "1.0000",
+		}
+	}
+	return products
+}
+
+func TestFetchOrderBundlePagination(t *testing.T) {
+	source := memorySource(t)
+	order, err := source.GetOrder(4200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pages are 50 products long, so 50 and 100 end on an empty page
+	for _, n := range []int{0, 1, 49, 50, 51, 100, 120} {
+		source.Products[4200] = testProducts(4200, n)
+		bundle, err := fetchOrderBundle(source, nil, order)
+		if err != nil {
+			t.Fatalf("%d products: %v", n, err)
+		}
+		if len(bundle.Products) != n {
+			t.Errorf("expected %d products, got %d", n, len(bundle.Products))
+		}
+	}
+}
+
+func TestConvertOrderFromSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(order *bigcommerce.Order, address *bigcommerce.ShippingAddress)
+		want   Delivery
+	}{
+		{"flat rate is delivered", func(*bigcommerce.Order, *bigcommerce.ShippingAddress) {}, DELIVERY},
+		{"flat rate is delivered even when free", func(o *bigcommerce.Order, _ *bigcommerce.ShippingAddress) {
+			o.ShippingCostExTax = "0.0000"
+		}, DELIVERY},
+		{"free shipping is collected", func(o *bigcommerce.Order, a *bigcommerce.ShippingAddress) {
+			o.ShippingCostExTax = "0.0000"
+			a.ShippingMethod = "Pickup In Store"
+		}, COLLECTION},
+		{"paid shipping is delivered", func(o *bigcommerce.Order, a *bigcommerce.ShippingAddress) {
+			a.ShippingMethod = "Courier"
+		}, DELIVERY},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := memorySource(t)
+			order, _ := source.GetOrder(4200)
+			address := source.ShippingAddresses[4200][0]
+			tt.update(&order, &address)
+			source.ShippingAddresses[4200] = []bigcommerce.ShippingAddress{address}
+
+			bundle, err := fetchOrderBundle(source, []DateSource{customerMessageDates{}}, order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hireJob, _, err := testConverter.Convert(bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hireJob.DeliveryType != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, hireJob.DeliveryType)
+			}
+		})
+	}
+}
+
+func TestConvertOrderWithoutShippingAddress(t *testing.T) {
+	source := memorySource(t)
+	delete(source.ShippingAddresses, 4200)
+	order, _ := source.GetOrder(4200)
+
+	bundle, err := fetchOrderBundle(source, []DateSource{customerMessageDates{}}, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = testConverter.Convert(bundle)
+	if outcomeOf(err) != OutcomeValidationFailed {
+		t.Errorf("expected a validation failure, got %v", err)
+	}
+}
+
+func TestConvertBundle(t *testing.T) {
+	source := memorySource(t)
+	order, _ := source.GetOrder(4200)
+	collection, instructions := COLLECTION, "Leave at reception"
+	bundle := OrderBundle{
+		Order:             order,
+		Products:          source.Products[4200],
+		ShippingAddresses: source.ShippingAddresses[4200],
+		Dates:             HireDates{Delivery: "06-12-2024", Collection: "09-12-2024"},
+		Edits:             QuarantineEdits{DeliveryType: &collection, DeliveryInstructions: &instructions},
+	}
+
+	hireJob, warnings, err := testConverter.Convert(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hireJob.DeliveryDate != "06-12-2024" || hireJob.CollectionDate != "09-12-2024" || hireJob.DeliveryType != COLLECTION || hireJob.DeliveryInstructions != instructions {
+		t.Errorf("expected the bundle's dates and edits, got %+v", hireJob)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", warnings)
+	}
+
+	// warnings are worked out from the edited hire job
+	bundle.Dates = HireDates{}
+	if _, warnings, _ = testConverter.Convert(bundle); len(warnings) != 1 || warnings[0].Code != WarningMissingDates {
+		t.Errorf("expected a missing dates warning, got %v", warnings)
+	}
+	deliveryDate, collectionDate := "06-12-2024", "09-12-2024"
+	bundle.Edits.DeliveryDate, bundle.Edits.CollectionDate = &deliveryDate, &collectionDate
+	if _, warnings, _ = testConverter.Convert(bundle); len(warnings) != 0 {
+		t.Errorf("expected edited dates to clear the warning, got %v", warnings)
+	}
+}
+
+func TestFetchOrdersFromSource(t *testing.T) {
+	source := memorySource(t)
+	for id := 4300; id < 4300+2*ordersPageLimit; id++ {
+		source.Orders = append(source.Orders, bigcommerce.Order{ID: id, StatusID: 9})
+	}
+
+	orders, err := fetchOrders(source, 4201, []int{11, 1}, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	if want := []int{4201, 4202, 4203}; !slices.Equal(ids, want) {
+		t.Errorf("expected %v, got %v", want, ids)
+	}
+
+	// exactly two full pages, so the last request is for an empty page, then
+	// capped part way through the first
+	orders, err = fetchOrders(source, 0, []int{9}, 2*ordersPageLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2*ordersPageLimit || orders[0].ID != 4300 {
+		t.Errorf("expected every awaiting shipment order, got %d from %d", len(orders), orders[0].ID)
+	}
+	orders, err = fetchOrders(source, 0, []int{9}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 10 {
+		t.Errorf("expected the cap of 10 orders, got %d", len(orders))
+	}
+}
+
+// The API answers a page past the end with an empty 204, which the client
+// reports as an error.
+func TestBigCommerceSourceEmptyPages(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	fake.mu.Lock()
+	fake.products[4200] = testProducts(4200, 50)
+	delete(fake.shippingAddresses, 4200)
+	fake.mu.Unlock()
+
+	source := newBigCommerceSource(bigcommerce.NewClient(fakeStoreHash, fakeAuthToken, nil, nil))
+	bundle, err := fetchOrderBundle(source, nil, fake.order(4200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundle.Products) != 50 || len(bundle.ShippingAddresses) != 0 {
+		t.Errorf("expected 50 products and no shipping addresses, got %d and %d", len(bundle.Products), len(bundle.ShippingAddresses))
+	}
+}
+
+// offlineTransport fails every request, so a test can tell if anything
+// reached for the network.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return nil, errors.New("unexpected request to " + r.URL.String())
+}
+
+func TestGenerateFilesFromMemorySource(t *testing.T) {
+	transport := http.DefaultClient.Transport
+	http.DefaultClient.Transport = offlineTransport{}
+	t.Cleanup(func() { http.DefaultClient.Transport = transport })
+
+	source := memorySource(t)
+	db := testDatabase(t)
+	outputDir := t.TempDir()
+	store := testStore(outputDir)
+	store.WriteBack = WriteBackConfig{StaffNote: true, Metafield: &MetafieldConfig{Namespace: "hire", Key: "export"}}
+	opts := GenerateOptions{Source: func(StoreConfig) OrderSource { return source }}
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, orderID := range []int{4200, 4201} {
+		name := orderDocumentName(orderID) + ".xml"
+		got, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("expected a file for order %d: %v", orderID, err)
+		}
+		assertGolden(t, name, got)
+
+		order, _ := source.GetOrder(orderID)
+		if !strings.Contains(order.StaffNotes, "Exported to the hire system as "+name) {
+			t.Errorf("expected a staff note on order %d, got %q", orderID, order.StaffNotes)
+		}
+		if metafields, _ := source.GetOrderMetafields(orderID, "hire"); len(metafields) != 1 {
+			t.Errorf("expected a hire.export metafield on order %d, got %+v", orderID, metafields)
+		}
+	}
+}
+
+func TestBigCommerceSourceMetafieldNamespaceEscaped(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	source := newBigCommerceSource(bigcommerce.NewClient(fakeStoreHash, fakeAuthToken, nil, nil))
+
+	namespace := "hire&dates=1 #2"
+	if err := source.SetOrderMetafield(4200, OrderMetafield{Namespace: namespace, Key: "delivery", Value: "2024-12-06"}); err != nil {
+		t.Fatal(err)
+	}
+	metafields, err := source.GetOrderMetafields(4200, namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metafields) != 1 || metafields[0].Namespace != namespace {
+		t.Errorf("expected the metafield in namespace %q, got %+v", namespace, metafields)
+	}
+}
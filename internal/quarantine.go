@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// QuarantineEdits are fields staff have corrected on a quarantined order.
+// A nil field keeps the value converted from BigCommerce.
+type QuarantineEdits struct {
+	DeliveryDate         *string
+	CollectionDate       *string
+	DeliveryInstructions *string
+	DeliveryType         *Delivery
+}
+
+// QuarantinedOrder is an order held back for review, with the BigCommerce
+// data it was converted from so it can be released without fetching it again.
+type QuarantinedOrder struct {
+	Website       string
+	OrderID       int
+	Reason        string
+	Warnings      []Warning
+	Data          OrderBundle
+	Edits         QuarantineEdits
+	QuarantinedAt time.Time
+	ReleasedAt    *time.Time
+}
+
+// QuarantineOrder adds an order to the review queue. If it is already there
+// its data and reason are refreshed and any edits are kept.
+func QuarantineOrder(db *sql.DB, website string, data OrderBundle, reason string, warnings []Warning) error {
+	orderJSON, err := json.Marshal(data.Order)
+	if err != nil {
+		return err
+	}
+	productsJSON, err := json.Marshal(data.Products)
+	if err != nil {
+		return err
+	}
+	shippingJSON, err := json.Marshal(data.ShippingAddresses)
+	if err != nil {
+		return err
+	}
+	warningsJSON, err := json.Marshal(warnings)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+	INSERT INTO quarantined_orders(website, order_id, reason, warnings, order_json, products_json, shipping_addresses_json, quarantined_at)
+	VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(website, order_id) DO UPDATE SET
+		reason = excluded.reason,
+		warnings = excluded.warnings,
+		order_json = excluded.order_json,
+		products_json = excluded.products_json,
+		shipping_addresses_json = excluded.shipping_addresses_json`,
+		website, data.Order.ID, reason, string(warningsJSON), string(orderJSON), string(productsJSON), string(shippingJSON), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error quarantining order %d: %w", data.Order.ID, err)
+	}
+	return nil
+}
+
+// EditQuarantinedOrder corrects fields on a quarantined order before it is
+// released. Dates are in DD-MM-YYYY format.
+func EditQuarantinedOrder(db *sql.DB, website string, orderID int, edits QuarantineEdits) error {
+	for _, date := range []*string{edits.DeliveryDate, edits.CollectionDate} {
+		if date == nil {
+			continue
+		}
+		if _, err := time.Parse(hireDateLayout, *date); err != nil {
+			return fmt.Errorf("invalid date %q, expected DD-MM-YYYY", *date)
+		}
+	}
+	if edits.DeliveryType != nil && *edits.DeliveryType != DELIVERY && *edits.DeliveryType != COLLECTION {
+		return fmt.Errorf("invalid delivery type %d", *edits.DeliveryType)
+	}
+
+	res, err := db.Exec(`
+	UPDATE quarantined_orders SET
+		delivery_date = COALESCE(?, delivery_date),
+		collection_date = COALESCE(?, collection_date),
+		delivery_instructions = COALESCE(?, delivery_instructions),
+		delivery_type = COALESCE(?, delivery_type)
+	WHERE website = ? AND order_id = ? AND released_at IS NULL`,
+		edits.DeliveryDate, edits.CollectionDate, edits.DeliveryInstructions, edits.DeliveryType, website, orderID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s order %d is not waiting in quarantine", website, orderID)
+	}
+	return nil
+}
+
+// ReleaseOrder writes the file for a quarantined order from its stored data
+// and edits, whatever its warnings. The order stays in quarantine, with the
+// new reason, if it still fails validation.
+func ReleaseOrder(db *sql.DB, store StoreConfig, orderID int) error {
+	q, ok, err := GetQuarantinedOrder(db, store.Website, orderID)
+	if err != nil {
+		return err
+	}
+	if !ok || q.ReleasedAt != nil {
+		return fmt.Errorf("%s order %d is not waiting in quarantine", store.Website, orderID)
+	}
+
+	source := NewOrderSource(store)
+	if store, err = resolveWriteBack(source, store); err != nil {
+		return err
+	}
+	bundle := q.Data
+	bundle.Edits = q.Edits
+	err = bundle.findHireDates(dateSources(db, source, store))
+	var hireJob Order
+	var warnings []Warning
+	if err == nil {
+		hireJob, warnings, err = newConverter(store).Convert(bundle)
+	}
+	if err != nil {
+		if _, uerr := db.Exec(`UPDATE quarantined_orders SET reason = ? WHERE website = ? AND order_id = ?`, err.Error(), store.Website, orderID); uerr != nil {
+			return uerr
+		}
+		return fmt.Errorf("order %d still cannot be exported: %w", orderID, err)
+	}
+	if len(warnings) > 0 {
+		log.Printf("[WARNING] releasing order %d despite warnings: %s", orderID, joinWarnings(warnings))
+	}
+
+	fileName, err := writeOrderFile(db, store, orderID, hireJob, false)
+	if err != nil {
+		return err
+	}
+	if err := writeBack(source, store, q.Data.Order, fileName, time.Now()); err != nil {
+		log.Printf("[ERROR] order %d was exported but could not be updated in BigCommerce: %v", orderID, err)
+	}
+	if _, err := db.Exec(`UPDATE quarantined_orders SET released_at = ? WHERE website = ? AND order_id = ?`, time.Now().UTC(), store.Website, orderID); err != nil {
+		return err
+	}
+	return RecordAttempt(db, store.Website, orderID, nil)
+}
+
+// awaitingReview reports whether an order is in quarantine and has not been
+// released.
+func awaitingReview(db *sql.DB, website string, orderID int) (bool, error) {
+	var waiting bool
+	err := db.QueryRow(`SELECT released_at IS NULL FROM quarantined_orders WHERE website = ? AND order_id = ?`, website, orderID).Scan(&waiting)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return waiting, err
+}
+
+func quarantineReleased(db *sql.DB, website string, orderID int) (bool, error) {
+	var released bool
+	err := db.QueryRow(`SELECT released_at IS NOT NULL FROM quarantined_orders WHERE website = ? AND order_id = ?`, website, orderID).Scan(&released)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return released, err
+}
+
+const quarantineColumns = `website, order_id, reason, warnings, order_json, products_json, shipping_addresses_json,
+	delivery_date, collection_date, delivery_instructions, delivery_type, quarantined_at, released_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanQuarantinedOrder(row rowScanner) (QuarantinedOrder, error) {
+	var q QuarantinedOrder
+	var warnings, orderJSON, productsJSON, shippingJSON string
+	var deliveryDate, collectionDate, deliveryInstructions sql.NullString
+	var deliveryType sql.NullInt64
+	if err := row.Scan(&q.Website, &q.OrderID, &q.Reason, &warnings, &orderJSON, &productsJSON, &shippingJSON,
+		&deliveryDate, &collectionDate, &deliveryInstructions, &deliveryType, &q.QuarantinedAt, &q.ReleasedAt); err != nil {
+		return QuarantinedOrder{}, err
+	}
+
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  any
+	}{
+		{"warnings", warnings, &q.Warnings},
+		{"order", orderJSON, &q.Data.Order},
+		{"products", productsJSON, &q.Data.Products},
+		{"shipping addresses", shippingJSON, &q.Data.ShippingAddresses},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(field.value), field.dest); err != nil {
+			return QuarantinedOrder{}, fmt.Errorf("order %d has malformed %s: %w", q.OrderID, field.name, err)
+		}
+	}
+
+	if deliveryDate.Valid {
+		q.Edits.DeliveryDate = &deliveryDate.String
+	}
+	if collectionDate.Valid {
+		q.Edits.CollectionDate = &collectionDate.String
+	}
+	if deliveryInstructions.Valid {
+		q.Edits.DeliveryInstructions = &deliveryInstructions.String
+	}
+	if deliveryType.Valid {
+		t := Delivery(deliveryType.Int64)
+		q.Edits.DeliveryType = &t
+	}
+	return q, nil
+}
+
+// GetQuarantinedOrder returns an order from the review queue, if it is there.
+func GetQuarantinedOrder(db *sql.DB, website string, orderID int) (QuarantinedOrder, bool, error) {
+	row := db.QueryRow(`SELECT `+quarantineColumns+` FROM quarantined_orders WHERE website = ? AND order_id = ?`, website, orderID)
+	q, err := scanQuarantinedOrder(row)
+	if err == sql.ErrNoRows {
+		return QuarantinedOrder{}, false, nil
+	}
+	if err != nil {
+		return QuarantinedOrder{}, false, err
+	}
+	return q, true, nil
+}
+
+// QuarantinedOrders lists the orders waiting for review. An empty website
+// lists them for every store.
+func QuarantinedOrders(db *sql.DB, website string) ([]QuarantinedOrder, error) {
+	rows, err := db.Query(`
+	SELECT `+quarantineColumns+`
+	FROM quarantined_orders q
+	WHERE (? = '' OR q.website = ?)
+		AND q.released_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.website = q.website AND o.order_id = q.order_id)
+	ORDER BY q.website, q.order_id`, website, website)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quarantined []QuarantinedOrder
+	for rows.Next() {
+		q, err := scanQuarantinedOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		quarantined = append(quarantined, q)
+	}
+	return quarantined, rows.Err()
+}
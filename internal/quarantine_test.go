@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+func TestQuarantineInvalidOrder(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	fake.updateOrder(4200, func(o *bigcommerce.Order) {
+		o.CustomerMessage = strings.Repeat("please ring the bell ", 30) + o.CustomerMessage
+	})
+
+	err := GenerateFile(db, store, 4200)
+	if !errors.Is(err, ErrQuarantined) || outcomeOf(err) != OutcomeQuarantined {
+		t.Fatalf("expected order 4200 to be quarantined, got %v", err)
+	}
+
+	q, ok, err := GetQuarantinedOrder(db, store.Website, 4200)
+	if err != nil || !ok {
+		t.Fatalf("expected order 4200 in quarantine: %v, %v", ok, err)
+	}
+	if !strings.Contains(q.Reason, "too many characters") {
+		t.Errorf("expected the validation failure as the reason, got %q", q.Reason)
+	}
+	if q.Data.Order.ID != 4200 || len(q.Data.Products) == 0 || len(q.Data.ShippingAddresses) == 0 {
+		t.Errorf("expected the raw order, products and shipping addresses to be kept, got %+v", q.Data)
+	}
+
+	// releasing without fixing it keeps it in quarantine
+	if err := ReleaseOrder(db, store, 4200); err == nil {
+		t.Fatal("expected releasing an invalid order to fail")
+	}
+	if quarantined, _ := QuarantinedOrders(db, store.Website); len(quarantined) != 1 {
+		t.Fatalf("expected order 4200 to still be quarantined, got %+v", quarantined)
+	}
+
+	instructions := "Ring the bell"
+	collection := COLLECTION
+	deliveryDate := "05-12-2024"
+	if err := EditQuarantinedOrder(db, store.Website, 4200, QuarantineEdits{DeliveryInstructions: &instructions, DeliveryType: &collection}); err != nil {
+		t.Fatal(err)
+	}
+	// edits are merged with the ones made before
+	if err := EditQuarantinedOrder(db, store.Website, 4200, QuarantineEdits{DeliveryDate: &deliveryDate}); err != nil {
+		t.Fatal(err)
+	}
+	bad := "2024-12-05"
+	if err := EditQuarantinedOrder(db, store.Website, 4200, QuarantineEdits{CollectionDate: &bad}); err == nil {
+		t.Error("expected an error for a date not in DD-MM-YYYY format")
+	}
+
+	// products and addresses come from the stored data, not BigCommerce
+	productRequests := fake.requestCount("/orders/4200/products")
+	if err := ReleaseOrder(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requestCount("/orders/4200/products") != productRequests {
+		t.Error("releasing the order fetched its products again")
+	}
+
+	b, err := os.ReadFile(orderFileName(store, 4200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<Deliveryinstructions>Ring the bell</Deliveryinstructions>",
+		"<DeliveryType>1</DeliveryType>",
+		"<DeliveryDate>05-12-2024</DeliveryDate>",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected the released file to contain %s, got\n%s", want, b)
+		}
+	}
+
+	if exported, _ := orderExported(db, 4200, store.Website); !exported {
+		t.Error("expected the released order to be recorded in the orders table")
+	}
+	if failed, _ := FailedOrders(db, store.Website); len(failed) != 0 {
+		t.Errorf("expected no failed orders after the release, got %+v", failed)
+	}
+}
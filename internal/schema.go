@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ordersSchema is the contract with the hire system's importer, generated from
+// the Orders type by generateSchema. The element names, including their odd
+// casing, are what the importer matches on, so a change to them is a change to
+// the contract. Regenerate it with go test -run TestSchema -update.
+//
+//go:embed schema/orders.xsd
+var ordersSchema []byte
+
+const xsdNamespace = "http://www.w3.org/2001/XMLSchema"
+
+// schemaEnumerations are the values allowed for types with a fixed set of
+// them.
+var schemaEnumerations = map[reflect.Type][]string{
+	reflect.TypeFor[Delivery](): {strconv.Itoa(int(DELIVERY)), strconv.Itoa(int(COLLECTION))},
+	reflect.TypeFor[Action]():   {string(ActionAmend), string(ActionCancel)},
+}
+
+// xsdSchema is the subset of XML Schema the contract uses: named complex types
+// holding a sequence of elements, and named simple types restricting a
+// built-in type.
+type xsdSchema struct {
+	Elements     []xsdElement     `xml:"element"`
+	ComplexTypes []xsdComplexType `xml:"complexType"`
+	SimpleTypes  []xsdSimpleType  `xml:"simpleType"`
+}
+
+type xsdElement struct {
+	Name      string `xml:"name,attr"`
+	Type      string `xml:"type,attr"`
+	MinOccurs string `xml:"minOccurs,attr"`
+	MaxOccurs string `xml:"maxOccurs,attr"`
+}
+
+type xsdComplexType struct {
+	Name     string       `xml:"name,attr"`
+	Elements []xsdElement `xml:"sequence>element"`
+}
+
+type xsdSimpleType struct {
+	Name        string         `xml:"name,attr"`
+	Restriction xsdRestriction `xml:"restriction"`
+}
+
+type xsdRestriction struct {
+	Base   string     `xml:"base,attr"`
+	Facets []xsdFacet `xml:",any"`
+}
+
+// xsdFacet is an enumeration, maxLength, minInclusive or pattern.
+type xsdFacet struct {
+	XMLName xml.Name
+	Value   string `xml:"value,attr"`
+}
+
+// generateSchema builds the XSD for the Orders type from its xml struct tags.
+// Fields can add facets and occurrence limits with an xsd tag, e.g.
+// `xsd:"maxLength=512"`, separating several with semicolons.
+func generateSchema() []byte {
+	var schema xsdSchema
+	schema.Elements = append(schema.Elements, xsdElement{Name: "Orders", Type: "Orders"})
+
+	seen := map[string]bool{}
+	queue := []reflect.Type{reflect.TypeFor[Orders]()}
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if seen[t.Name()] {
+			continue
+		}
+		seen[t.Name()] = true
+
+		if values, ok := schemaEnumerations[t]; ok {
+			simple := xsdSimpleType{Name: t.Name(), Restriction: xsdRestriction{Base: builtinSchemaType(t)}}
+			for _, v := range values {
+				simple.Restriction.Facets = append(simple.Restriction.Facets, xsdFacet{XMLName: xml.Name{Local: "enumeration"}, Value: v})
+			}
+			schema.SimpleTypes = append(schema.SimpleTypes, simple)
+			continue
+		}
+
+		complex := xsdComplexType{Name: t.Name()}
+		for _, field := range reflect.VisibleFields(t) {
+			tag := field.Tag.Get("xml")
+			if !field.IsExported() || tag == "-" || field.Name == "XMLName" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			element := xsdElement{Name: name}
+			if strings.Contains(options, "omitempty") {
+				element.MinOccurs = "0"
+			}
+
+			ft := field.Type
+			if ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+				element.MinOccurs, element.MaxOccurs = "0", "unbounded"
+			}
+			if _, ok := schemaEnumerations[ft]; ok || ft.Kind() == reflect.Struct {
+				element.Type = ft.Name()
+				queue = append(queue, ft)
+			} else {
+				element.Type = builtinSchemaType(ft)
+			}
+
+			var facets []xsdFacet
+			for _, rule := range strings.Split(field.Tag.Get("xsd"), ";") {
+				key, value, ok := strings.Cut(rule, "=")
+				switch {
+				case !ok:
+				case key == "minOccurs":
+					element.MinOccurs = value
+				case key == "maxOccurs":
+					element.MaxOccurs = value
+				default:
+					facets = append(facets, xsdFacet{XMLName: xml.Name{Local: key}, Value: value})
+				}
+			}
+			if len(facets) > 0 {
+				restricted := xsdSimpleType{Name: t.Name() + field.Name, Restriction: xsdRestriction{Base: element.Type, Facets: facets}}
+				schema.SimpleTypes = append(schema.SimpleTypes, restricted)
+				element.Type = restricted.Name
+			}
+			complex.Elements = append(complex.Elements, element)
+		}
+		schema.ComplexTypes = append(schema.ComplexTypes, complex)
+	}
+
+	return schema.render()
+}
+
+func builtinSchemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "xs:int"
+	case reflect.Float32, reflect.Float64:
+		return "xs:decimal"
+	}
+	return "xs:string"
+}
+
+// render writes the schema out with the xs prefix, which encoding/xml cannot
+// do itself.
+func (s xsdSchema) render() []byte {
+	var b bytes.Buffer
+	attr := func(name, value string) {
+		if value == "" {
+			return
+		}
+		fmt.Fprintf(&b, ` %s="`, name)
+		xml.EscapeText(&b, []byte(value))
+		b.WriteString(`"`)
+	}
+	element := func(indent string, e xsdElement) {
+		b.WriteString(indent + "<xs:element")
+		attr("name", e.Name)
+		attr("type", e.Type)
+		attr("minOccurs", e.MinOccurs)
+		attr("maxOccurs", e.MaxOccurs)
+		b.WriteString("/>\n")
+	}
+
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, "<xs:schema xmlns:xs=%q elementFormDefault=\"qualified\">\n", xsdNamespace)
+	for _, e := range s.Elements {
+		element("  ", e)
+	}
+	for _, c := range s.ComplexTypes {
+		fmt.Fprintf(&b, "  <xs:complexType name=%q>\n    <xs:sequence>\n", c.Name)
+		for _, e := range c.Elements {
+			element("      ", e)
+		}
+		b.WriteString("    </xs:sequence>\n  </xs:complexType>\n")
+	}
+	for _, st := range s.SimpleTypes {
+		fmt.Fprintf(&b, "  <xs:simpleType name=%q>\n    <xs:restriction base=%q>\n", st.Name, st.Restriction.Base)
+		for _, f := range st.Restriction.Facets {
+			b.WriteString("      <xs:" + f.XMLName.Local)
+			attr("value", f.Value)
+			b.WriteString("/>\n")
+		}
+		b.WriteString("    </xs:restriction>\n  </xs:simpleType>\n")
+	}
+	b.WriteString("</xs:schema>\n")
+	return b.Bytes()
+}
+
+// schemaValidator checks documents against an xsdSchema.
+type schemaValidator struct {
+	root         map[string]string
+	complexTypes map[string]xsdComplexType
+	simpleTypes  map[string]xsdSimpleType
+	// patterns are each simple type's pattern facets, any one of which a
+	// value must match.
+	patterns map[string][]*regexp.Regexp
+}
+
+func newSchemaValidator(xsd []byte) (*schemaValidator, error) {
+	var schema xsdSchema
+	if err := xml.Unmarshal(xsd, &schema); err != nil {
+		return nil, fmt.Errorf("error parsing schema: %w", err)
+	}
+
+	v := &schemaValidator{
+		root:         map[string]string{},
+		complexTypes: map[string]xsdComplexType{},
+		simpleTypes:  map[string]xsdSimpleType{},
+		patterns:     map[string][]*regexp.Regexp{},
+	}
+	for _, e := range schema.Elements {
+		v.root[e.Name] = e.Type
+	}
+	for _, c := range schema.ComplexTypes {
+		v.complexTypes[c.Name] = c
+	}
+	for _, s := range schema.SimpleTypes {
+		v.simpleTypes[s.Name] = s
+		for _, f := range s.Restriction.Facets {
+			if f.XMLName.Local != "pattern" {
+				continue
+			}
+			// XSD patterns match the whole value
+			re, err := regexp.Compile(`^(?:` + f.Value + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("simple type %s has a bad pattern: %w", s.Name, err)
+			}
+			v.patterns[s.Name] = append(v.patterns[s.Name], re)
+		}
+	}
+	return v, nil
+}
+
+var (
+	ordersValidator     *schemaValidator
+	ordersValidatorErr  error
+	ordersValidatorOnce sync.Once
+)
+
+// validateOrdersXML checks a marshalled document against the importer's
+// contract.
+func validateOrdersXML(data []byte) error {
+	ordersValidatorOnce.Do(func() {
+		ordersValidator, ordersValidatorErr = newSchemaValidator(ordersSchema)
+	})
+	if ordersValidatorErr != nil {
+		return ordersValidatorErr
+	}
+	return ordersValidator.validate(data)
+}
+
+func (v *schemaValidator) validate(data []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return fmt.Errorf("document has no root element")
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		typeName, ok := v.root[start.Name.Local]
+		if !ok {
+			return fmt.Errorf("unexpected root element %s", start.Name.Local)
+		}
+		return v.validateElement(d, start.Name.Local, typeName)
+	}
+}
+
+// validateElement checks the contents of an element whose start tag has just
+// been read, up to and including its end tag.
+func (v *schemaValidator) validateElement(d *xml.Decoder, path, typeName string) error {
+	complex, ok := v.complexTypes[typeName]
+	if !ok {
+		var text strings.Builder
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			switch t := tok.(type) {
+			case xml.CharData:
+				text.Write(t)
+			case xml.StartElement:
+				return fmt.Errorf("%s: unexpected element %s in a simple value", path, t.Name.Local)
+			case xml.EndElement:
+				if err := v.validateValue(typeName, text.String()); err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				return nil
+			}
+		}
+	}
+
+	i, count := 0, 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return fmt.Errorf("%s: unexpected text %q", path, bytes.TrimSpace(t))
+			}
+		case xml.StartElement:
+			// move along the sequence to the element, checking that any
+			// passed over have appeared often enough
+			for i < len(complex.Elements) && complex.Elements[i].Name != t.Name.Local {
+				if err := checkOccurs(path, complex.Elements[i], count); err != nil {
+					return err
+				}
+				i, count = i+1, 0
+			}
+			if i == len(complex.Elements) {
+				return fmt.Errorf("%s: unexpected element %s", path, t.Name.Local)
+			}
+			count++
+			if max := complex.Elements[i].MaxOccurs; max != "unbounded" && count > parseOccurs(max, 1) {
+				return fmt.Errorf("%s: too many %s elements", path, t.Name.Local)
+			}
+			if err := v.validateElement(d, path+"/"+t.Name.Local, complex.Elements[i].Type); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			for ; i < len(complex.Elements); i, count = i+1, 0 {
+				if err := checkOccurs(path, complex.Elements[i], count); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+}
+
+func checkOccurs(path string, e xsdElement, count int) error {
+	if count < parseOccurs(e.MinOccurs, 1) {
+		return fmt.Errorf("%s: missing %s", path, e.Name)
+	}
+	return nil
+}
+
+// parseOccurs parses a minOccurs or maxOccurs attribute, which defaults to def.
+func parseOccurs(value string, def int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// validateValue checks the text of a simple element against its type.
+func (v *schemaValidator) validateValue(typeName, value string) error {
+	simple, ok := v.simpleTypes[typeName]
+	if !ok {
+		return validateBuiltinValue(typeName, value)
+	}
+	if err := validateBuiltinValue(simple.Restriction.Base, value); err != nil {
+		return err
+	}
+
+	var enumeration, patterns []string
+	for _, f := range simple.Restriction.Facets {
+		switch f.XMLName.Local {
+		case "enumeration":
+			enumeration = append(enumeration, f.Value)
+		case "maxLength":
+			if max, _ := strconv.Atoi(f.Value); utf8.RuneCountInString(value) > max {
+				return fmt.Errorf("%d characters is more than the maximum of %d", utf8.RuneCountInString(value), max)
+			}
+		case "minInclusive":
+			n, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if min, _ := strconv.ParseFloat(f.Value, 64); n < min {
+				return fmt.Errorf("%s is less than the minimum of %s", value, f.Value)
+			}
+		case "pattern":
+			patterns = append(patterns, f.Value)
+		}
+	}
+	if len(patterns) > 0 && !slices.ContainsFunc(v.patterns[typeName], func(re *regexp.Regexp) bool { return re.MatchString(value) }) {
+		return fmt.Errorf("%q does not match the pattern %s", value, strings.Join(patterns, " or "))
+	}
+	if len(enumeration) > 0 && !slices.Contains(enumeration, strings.TrimSpace(value)) {
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(enumeration, ", "))
+	}
+	return nil
+}
+
+var decimalValue = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+func validateBuiltinValue(typeName, value string) error {
+	value = strings.TrimSpace(value)
+	switch typeName {
+	case "xs:int":
+		if _, err := strconv.ParseInt(value, 10, 32); err != nil {
+			return fmt.Errorf("%q is not an int", value)
+		}
+	case "xs:decimal":
+		if !decimalValue.MatchString(value) {
+			return fmt.Errorf("%q is not a decimal", value)
+		}
+	case "xs:string":
+	default:
+		return fmt.Errorf("unknown type %s", typeName)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSchema fails when a change to the Orders types changes the contract with
+// the importer. If the importer has been changed to match, regenerate
+// schema/orders.xsd with -update.
+func TestSchema(t *testing.T) {
+	got := generateSchema()
+	path := filepath.Join("schema", "orders.xsd")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if diff := unifiedDiff(path, "generated", ordersSchema, got); diff != "" {
+		t.Errorf("the Orders types no longer match the importer's contract:\n%s", diff)
+	}
+}
+
+func TestGoldenFilesMatchSchema(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden files")
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validateOrdersXML(b); err != nil {
+			t.Errorf("%s: %v", file, err)
+		}
+	}
+}
+
+func TestValidateOrdersXML(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "golden", "order4200.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := string(b)
+
+	tests := map[string]struct {
+		old, new string
+		want     string
+	}{
+		"missing element":       {"<TelNo>+353 1 555 0100</TelNo>", "", "missing TelNo"},
+		"renamed element":       {"<webenquiryid>4200</webenquiryid>", "<WebEnquiryId>4200</WebEnquiryId>", "missing webenquiryid"},
+		"repeated element":      {"<Email>aoife@example.com</Email>", "<Email>aoife@example.com</Email><Email>x</Email>", "too many Email"},
+		"bad date":              {"<DeliveryDate>06-12-2024</DeliveryDate>", "<DeliveryDate>2024-12-06</DeliveryDate>", "does not match the pattern"},
+		"job type":              {"<JobType>1</JobType>", "<JobType>0</JobType>", "less than the minimum"},
+		"delivery type":         {"<DeliveryType>0</DeliveryType>", "<DeliveryType>2</DeliveryType>", `"2" is not one of 0, 1`},
+		"price":                 {"<Price>12.5</Price>", "<Price>1.25e+01</Price>", "not a decimal"},
+		"quantity":              {"<Quantity>10</Quantity>", "<Quantity>ten</Quantity>", "not an int"},
+		"action":                {"<JobType>", "<Action>Delete</Action><JobType>", `"Delete" is not one of Amend, Cancel`},
+		"instructions too long": {"Please ring the bell at the side gate", strings.Repeat("x", 513), "more than the maximum of 512"},
+		"no orders":             {valid[strings.Index(valid, "<Order>"):strings.LastIndex(valid, "</Orders>")], "", "missing Order"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			doc := strings.Replace(valid, tt.old, tt.new, 1)
+			err := validateOrdersXML([]byte(doc))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	amend := strings.Replace(valid, "<JobType>", "<Action>Amend</Action><JobType>", 1)
+	if err := validateOrdersXML([]byte(amend)); err != nil {
+		t.Errorf("expected an amendment to be valid, got %v", err)
+	}
+}
+
+func TestWriteOrderFileValidatesSchema(t *testing.T) {
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+
+	_, err := writeOrderFile(db, store, 4200, Order{JobType: 1, DeliveryDate: "6/12/2024"}, false)
+	if outcomeOf(err) != OutcomeValidationFailed {
+		t.Fatalf("expected a validation failure, got %v", err)
+	}
+	if _, err := os.Stat(orderFileName(store, 4200)); !os.IsNotExist(err) {
+		t.Errorf("expected no file to be written, got %v", err)
+	}
+	if exported, _ := orderExported(db, 4200, store.Website); exported {
+		t.Error("expected the order not to be recorded as exported")
+	}
+}
+
+func TestSchemaPatterns(t *testing.T) {
+	v, err := newSchemaValidator([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="Date" type="Date"/>
+  <xs:simpleType name="Date">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="\d{2}-\d{2}-\d{4}"/>
+      <xs:pattern value="\d{8}"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"06-12-2024", "20241206"} {
+		if err := v.validate([]byte("<Date>" + value + "</Date>")); err != nil {
+			t.Errorf("%s: expected either pattern to match, got %v", value, err)
+		}
+	}
+	if err := v.validate([]byte("<Date>2024-12-06</Date>")); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected a value matching neither pattern to fail, got %v", err)
+	}
+}
+
+func TestDecimalsWithoutExponent(t *testing.T) {
+	for _, price := range []Decimal{1e21, 1e-7} {
+		orders := testOrders()
+		orders.Orders[0].OrderLineItems.Items[0].Price = price
+		b, err := (xmlEncoder{}).Encode(orders)
+		if err != nil {
+			t.Errorf("%v: %v", float64(price), err)
+			continue
+		}
+		if want := "<Price>" + price.String() + "</Price>"; strings.Contains(price.String(), "e") || !strings.Contains(string(b), want) {
+			t.Errorf("%v: expected %s in\n%s", float64(price), want, b)
+		}
+	}
+}
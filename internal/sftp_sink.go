@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultSFTPPort       = "22"
+	defaultSFTPRetries    = 3
+	defaultSFTPRetryDelay = 5 * time.Second
+)
+
+// validateSFTP checks the settings the sftp sink needs and fills in defaults.
+func (c *SinkConfig) validateSFTP() error {
+	if c.Host == "" || c.User == "" || c.KeyFile == "" || c.KnownHostsFile == "" || c.RemoteDir == "" {
+		return fmt.Errorf("sftp sink needs host, user, key_file, known_hosts_file and remote_dir")
+	}
+	if !path.IsAbs(c.RemoteDir) {
+		return fmt.Errorf("sftp sink remote_dir must be an absolute path, got %q", c.RemoteDir)
+	}
+	if _, _, err := net.SplitHostPort(c.Host); err != nil {
+		c.Host = net.JoinHostPort(c.Host, defaultSFTPPort)
+	}
+
+	if c.Retries < 0 || c.RetryDelay < 0 {
+		return fmt.Errorf("sftp sink retries and retry_delay cannot be negative")
+	}
+	if c.Retries == 0 {
+		c.Retries = defaultSFTPRetries
+	}
+	if c.RetryDelay == 0 {
+		c.RetryDelay = defaultSFTPRetryDelay
+	}
+	return nil
+}
+
+// sftpSink uploads documents to the importer's directory on another server. A
+// failed upload is tried again, over a new connection, up to the configured
+// number of retries.
+type sftpSink struct {
+	store StoreConfig
+}
+
+func (s sftpSink) Send(doc Document) (string, error) {
+	config := s.store.Sink
+	remotePath := path.Join(config.RemoteDir, doc.Name)
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = s.upload(remotePath, doc); err == nil {
+			break
+		}
+		if attempt == config.Retries {
+			return "", attemptError(OutcomeSendFailed, "error uploading %s to %s after %d attempts: %v", doc.Name, config.Host, attempt+1, err)
+		}
+		log.Printf("[WARNING] uploading %s to %s failed, retrying in %s: %v", doc.Name, config.Host, config.RetryDelay, err)
+		time.Sleep(config.RetryDelay)
+	}
+
+	return (&url.URL{Scheme: "sftp", User: url.User(config.User), Host: config.Host, Path: remotePath}).String(), nil
+}
+
+// Watched is false because CheckImports can only look in local directories.
+func (sftpSink) Watched() bool { return false }
+
+// upload connects to the server and writes the document and its handoff files
+// to remotePath.
+func (s sftpSink) upload(remotePath string, doc Document) error {
+	client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("error creating %s: %v", path.Dir(remotePath), err)
+	}
+	put := sftpPut(client, s.store.FileMode)
+	if err := put(remotePath, doc.Data); err != nil {
+		return err
+	}
+	return handOff(s.store, put, remotePath, doc)
+}
+
+// dial logs in to the server with the store's key, checking the server's host
+// key against known_hosts_file.
+func (s sftpSink) dial() (*sftp.Client, error) {
+	config := s.store.Sink
+	key, err := os.ReadFile(config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sftp key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sftp key %s: %v", config.KeyFile, err)
+	}
+	hostKeyCallback, err := knownhosts.New(config.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading known hosts: %v", err)
+	}
+
+	conn, err := ssh.Dial("tcp", config.Host, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         config.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", config.Host, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error starting sftp on %s: %v", config.Host, err)
+	}
+	return client, nil
+}
+
+// sftpPut uploads each file to a temp name beside it and renames it into
+// place, so the importer never sees part of one. The temp file is removed if
+// anything fails.
+func sftpPut(client *sftp.Client, fileMode FileMode) putFunc {
+	return func(remotePath string, data []byte) (err error) {
+		suffix := make([]byte, 8)
+		if _, err := rand.Read(suffix); err != nil {
+			return err
+		}
+		dir, name := path.Split(remotePath)
+		tempPath := path.Join(dir, tempFilePrefix+name+tempFileInfix+hex.EncodeToString(suffix))
+
+		file, err := client.Create(tempPath)
+		if err != nil {
+			return fmt.Errorf("error creating %s: %v", tempPath, err)
+		}
+		defer func() {
+			if err != nil {
+				file.Close()
+				client.Remove(tempPath)
+			}
+		}()
+
+		if _, err := file.Write(data); err != nil {
+			return fmt.Errorf("error writing %s: %v", tempPath, err)
+		}
+		if err := file.Chmod(os.FileMode(fileMode)); err != nil {
+			return fmt.Errorf("error setting permissions on %s: %v", tempPath, err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("error closing %s: %v", tempPath, err)
+		}
+		if err := client.PosixRename(tempPath, remotePath); err != nil {
+			return fmt.Errorf("error renaming %s to %s: %v", tempPath, remotePath, err)
+		}
+		return nil
+	}
+}
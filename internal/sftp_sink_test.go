@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpServer is an SFTP server on localhost that only lets in the test's
+// client key. Its first rejectFirst connections are dropped before the
+// handshake.
+type sftpServer struct {
+	addr        string
+	connections atomic.Int32
+	rejectFirst atomic.Int32
+	config      *ssh.ServerConfig
+}
+
+// newSFTPServer starts a server and returns a sink config that logs in to it,
+// with the client key and known_hosts file written to a temp directory.
+func newSFTPServer(t *testing.T) (*sftpServer, SinkConfig) {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPublic, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &sftpServer{config: &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "hire" && string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}}
+	s.config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s.addr = ln.Addr().String()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := SinkConfig{
+		Type:           SinkSFTP,
+		Host:           s.addr,
+		User:           "hire",
+		KeyFile:        keyFile,
+		KnownHostsFile: knownHostsFile,
+		RemoteDir:      filepath.Join(t.TempDir(), "import"),
+		RetryDelay:     time.Millisecond,
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return s, config
+}
+
+func (s *sftpServer) serve(conn net.Conn) {
+	if s.connections.Add(1) <= s.rejectFirst.Load() {
+		conn.Close()
+		return
+	}
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				isSFTP := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(isSFTP, nil)
+				if !isSFTP {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				go func() {
+					server.Serve()
+					server.Close()
+				}()
+			}
+		}()
+	}
+}
+
+func TestSFTPSink(t *testing.T) {
+	_, config := newSFTPServer(t)
+	store := testStore("")
+	store.Sink = config
+	store.Handoff = HandoffReady
+	sink := newSink(store)
+
+	location, err := sink.Send(Document{Name: "order4200.xml", Data: []byte("<Orders></Orders>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remotePath := filepath.Join(config.RemoteDir, "order4200.xml")
+	if want := "sftp://hire@" + config.Host + remotePath; location != want {
+		t.Errorf("expected location %s, got %s", want, location)
+	}
+	if sink.Watched() {
+		t.Error("expected the sftp sink not to be watched")
+	}
+
+	b, err := os.ReadFile(remotePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "<Orders></Orders>" {
+		t.Errorf("unexpected contents %s", b)
+	}
+	if _, err := os.Stat(remotePath + ".ready"); err != nil {
+		t.Errorf("expected a ready file: %v", err)
+	}
+	entries, err := os.ReadDir(config.RemoteDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), tempFileInfix) {
+			t.Errorf("temp file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestSFTPSinkRetries(t *testing.T) {
+	server, config := newSFTPServer(t)
+	config.Retries = 2
+	store := testStore("")
+	store.Sink = config
+
+	server.rejectFirst.Store(2)
+	if _, err := newSink(store).Send(Document{Name: "order4200.xml"}); err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+
+	server.connections.Store(0)
+	server.rejectFirst.Store(3)
+	if _, err := newSink(store).Send(Document{Name: "order4201.xml"}); err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("expected the upload to fail after 3 attempts, got %v", err)
+	}
+}
+
+func TestSFTPSinkUnknownHostKey(t *testing.T) {
+	_, config := newSFTPServer(t)
+	_, other := newSFTPServer(t)
+	config.KnownHostsFile = other.KnownHostsFile
+	config.Retries = 1
+	store := testStore("")
+	store.Sink = config
+
+	if _, err := newSink(store).Send(Document{Name: "order4200.xml"}); err == nil {
+		t.Fatal("expected a server with an unknown host key to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(config.RemoteDir, "order4200.xml")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be uploaded, got %v", err)
+	}
+}
+
+func TestGenerateFilesSFTPSink(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	_, config := newSFTPServer(t)
+	db := testDatabase(t)
+	store := testStore("")
+	store.Sink = config
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := queryExportedFiles(db, `WHERE website = ?`, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected orders 4200 and 4201 to be recorded, got %+v", files)
+	}
+	for _, f := range files {
+		name := orderDocumentName(f.OrderID) + ".xml"
+		if !strings.HasPrefix(f.FilePath, "sftp://") || !strings.HasSuffix(f.FilePath, "/"+name) || f.ConsumedVia != ConsumedSent {
+			t.Errorf("unexpected record %+v", f)
+		}
+		got, err := os.ReadFile(filepath.Join(config.RemoteDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertGolden(t, name, got)
+	}
+}
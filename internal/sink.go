@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SinkType is where a store's documents are sent.
+type SinkType string
+
+const (
+	// SinkLocal writes files to the store's output_dir for the importer to
+	// pick up.
+	SinkLocal SinkType = "local"
+	// SinkHTTP posts each document to the hire system's REST import.
+	SinkHTTP SinkType = "http"
+	// SinkSFTP uploads files to the importer's directory on another server.
+	SinkSFTP SinkType = "sftp"
+)
+
+const defaultSinkTimeout = 30 * time.Second
+
+// SinkConfig is where a store's documents are sent.
+type SinkConfig struct {
+	// Type is local, the default, http or sftp.
+	Type SinkType `yaml:"type"`
+	// URL is the endpoint the http sink posts to.
+	URL string `yaml:"url"`
+	// Headers are added to each post, e.g. an API key. $NAME and ${NAME} are
+	// read from the environment.
+	Headers map[string]string `yaml:"headers"`
+	// Timeout limits each post, or connecting to the sftp server, e.g.
+	// "10s".
+	Timeout time.Duration `yaml:"timeout"`
+
+	// Host is the sftp server, with its port if it is not 22.
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+	// KeyFile is the private key the sftp sink logs in with, and
+	// KnownHostsFile holds the server's host key.
+	KeyFile        string `yaml:"key_file"`
+	KnownHostsFile string `yaml:"known_hosts_file"`
+	// RemoteDir is the importer's directory on the sftp server.
+	RemoteDir string `yaml:"remote_dir"`
+	// Retries is how many more times a failed upload is tried, after
+	// RetryDelay.
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+func (c *SinkConfig) validate() error {
+	switch c.Type {
+	case "":
+		c.Type = SinkLocal
+	case SinkLocal:
+	case SinkHTTP:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("sink url must be an http or https URL, got %q", c.URL)
+		}
+	case SinkSFTP:
+		if err := c.validateSFTP(); err != nil {
+			return err
+		}
+	case "ftps":
+		return fmt.Errorf("sink type ftps is not supported, use sftp")
+	default:
+		return fmt.Errorf("sink type must be local, http or sftp, got %q", c.Type)
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("sink timeout cannot be negative")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultSinkTimeout
+	}
+	for name, value := range c.Headers {
+		c.Headers[name] = os.ExpandEnv(value)
+	}
+	return nil
+}
+
+// Document is an encoded file ready to be sent.
+type Document struct {
+	// Name is the file name, e.g. order4200.xml.
+	Name        string
+	Data        []byte
+	ContentType string
+	// OrderIDs lists the orders in a batch document. It is nil for a single
+	// order's.
+	OrderIDs []int
+}
+
+// Sink delivers documents to the hire system.
+type Sink interface {
+	// Send delivers doc and returns where it went, which is recorded as the
+	// order's file path.
+	Send(doc Document) (string, error)
+	// Watched reports whether documents wait to be picked up by the
+	// importer, so CheckImports should look for them. Documents that are not
+	// watched are recorded as consumed once they are sent.
+	Watched() bool
+}
+
+func newSink(store StoreConfig) Sink {
+	switch store.Sink.Type {
+	case SinkHTTP:
+		return httpSink{config: store.Sink, client: &http.Client{Timeout: store.Sink.Timeout}}
+	case SinkSFTP:
+		return sftpSink{store: store}
+	}
+	return localSink{store: store}
+}
+
+// localSink writes documents to the store's output directory so the importer
+// never sees part of one, then hands them off as the store is configured to.
+type localSink struct {
+	store StoreConfig
+}
+
+func (s localSink) Send(doc Document) (string, error) {
+	fileName := filepath.Join(s.store.OutputDir, doc.Name)
+	put := localPut(s.store)
+	if err := put(fileName, doc.Data); err != nil {
+		return "", err
+	}
+	if err := handOff(s.store, put, fileName, doc); err != nil {
+		return "", err
+	}
+	return fileName, nil
+}
+
+func (localSink) Watched() bool { return true }
+
+// httpSink posts each document to the hire system, which imports it before
+// responding.
+type httpSink struct {
+	config SinkConfig
+	client *http.Client
+}
+
+func (s httpSink) Send(doc Document) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(doc.Data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", doc.ContentType)
+	req.Header.Set("X-File-Name", doc.Name)
+	if doc.OrderIDs != nil {
+		ids := make([]string, len(doc.OrderIDs))
+		for i, id := range doc.OrderIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		req.Header.Set("X-Order-Ids", strings.Join(ids, ","))
+	}
+	for name, value := range s.config.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", attemptError(OutcomeSendFailed, "error posting %s: %v", doc.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		// a server error may clear up by the next run, but a rejected
+		// document will not, so its order is quarantined
+		outcome := OutcomeValidationFailed
+		if resp.StatusCode >= 500 {
+			outcome = OutcomeSendFailed
+		}
+		return "", attemptError(outcome, "error posting %s: %s: %s", doc.Name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return doc.Name, nil
+}
+
+func (httpSink) Watched() bool { return false }
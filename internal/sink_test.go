@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// importServer stands in for the hire system's REST import, keeping each
+// document posted to it.
+type importServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	status   int
+}
+
+func newImportServer(t *testing.T) *importServer {
+	s := &importServer{status: http.StatusCreated}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(s.status)
+		if s.status >= 400 {
+			io.WriteString(w, "job already exists\n")
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestHTTPSink(t *testing.T) {
+	server := newImportServer(t)
+	t.Setenv("HIRE_API_KEY", "secret")
+	config := SinkConfig{Type: SinkHTTP, URL: server.URL + "/import", Headers: map[string]string{"X-Api-Key": "${HIRE_API_KEY}"}}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sink := newSink(StoreConfig{Sink: config})
+
+	location, err := sink.Send(Document{Name: "orders-caterhire-001.json", Data: []byte(`{"orders":[]}`), ContentType: "application/json", OrderIDs: []int{4200, 4201}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != "orders-caterhire-001.json" || sink.Watched() {
+		t.Errorf("unexpected location %q or watched sink", location)
+	}
+
+	r := server.requests[0]
+	if r.Method != http.MethodPost || r.URL.Path != "/import" {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}
+	for header, want := range map[string]string{
+		"Content-Type": "application/json",
+		"X-File-Name":  "orders-caterhire-001.json",
+		"X-Order-Ids":  "4200,4201",
+		"X-Api-Key":    "secret",
+	} {
+		if got := r.Header.Get(header); got != want {
+			t.Errorf("%s: expected %q, got %q", header, want, got)
+		}
+	}
+	if string(server.bodies[0]) != `{"orders":[]}` {
+		t.Errorf("unexpected body %s", server.bodies[0])
+	}
+
+	server.mu.Lock()
+	server.status = http.StatusConflict
+	server.mu.Unlock()
+	_, err = sink.Send(Document{Name: "order4200.json"})
+	if err == nil || !strings.Contains(err.Error(), "job already exists") {
+		t.Errorf("expected the server's error, got %v", err)
+	}
+	if outcomeOf(err) != OutcomeValidationFailed {
+		t.Errorf("expected a rejected document to be %s, got %s", OutcomeValidationFailed, outcomeOf(err))
+	}
+
+	server.mu.Lock()
+	server.status = http.StatusBadGateway
+	server.mu.Unlock()
+	if _, err := sink.Send(Document{Name: "order4200.json"}); outcomeOf(err) != OutcomeSendFailed {
+		t.Errorf("expected a server error to be %s, got %v", OutcomeSendFailed, err)
+	}
+}
+
+func TestGenerateFilesHTTPSink(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	server := newImportServer(t)
+	db := testDatabase(t)
+	store := testStore("")
+	store.Format = FormatJSON
+	store.Sink = SinkConfig{Type: SinkHTTP, URL: server.URL, Timeout: defaultSinkTimeout}
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for i, r := range server.requests {
+		names = append(names, r.Header.Get("X-File-Name"))
+		var doc struct {
+			Orders []Order `json:"orders"`
+		}
+		if err := json.Unmarshal(server.bodies[i], &doc); err != nil || len(doc.Orders) != 1 {
+			t.Errorf("expected one order in %s, got %s", names[i], server.bodies[i])
+		}
+	}
+	if !slices.Equal(names, []string{"order4200.json", "order4201.json"}) {
+		t.Errorf("expected orders 4200 and 4201 to be posted, got %v", names)
+	}
+
+	// nothing waits in an output directory, so there is nothing to watch
+	pending, err := PendingImports(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending imports, got %+v", pending)
+	}
+	files, err := queryExportedFiles(db, `WHERE website = ? AND consumed_via = ?`, store.Website, ConsumedSent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected both orders to be recorded as sent, got %+v", files)
+	}
+}
+
+// A server error is journalled for the order, which is sent again on the next
+// run, rather than stopping the run.
+func TestGenerateFilesHTTPSinkServerError(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	server := newImportServer(t)
+	server.status = http.StatusServiceUnavailable
+	db := testDatabase(t)
+	store := testStore("")
+	store.Sink = SinkConfig{Type: SinkHTTP, URL: server.URL, Timeout: defaultSinkTimeout}
+	config := Config{Stores: []StoreConfig{store}}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.requests) != 2 {
+		t.Errorf("expected both orders to be tried, got %d posts", len(server.requests))
+	}
+	failed, err := FailedOrders(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sendFailed []int
+	for _, f := range failed {
+		if f.Outcome == OutcomeSendFailed {
+			sendFailed = append(sendFailed, f.OrderID)
+		}
+	}
+	if !slices.Equal(sendFailed, []int{4200, 4201}) {
+		t.Errorf("expected orders 4200 and 4201 to be journalled as %s, got %+v", OutcomeSendFailed, failed)
+	}
+
+	server.mu.Lock()
+	server.status = http.StatusCreated
+	server.mu.Unlock()
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, orderID := range []int{4200, 4201} {
+		if exported, _ := orderExported(db, orderID, store.Website); !exported {
+			t.Errorf("expected order %d to be sent on the next run", orderID)
+		}
+	}
+}
+
+// A rejected document would be rejected again, so its order is quarantined
+// with the response rather than posted on every run.
+func TestGenerateFilesHTTPSinkRejected(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	server := newImportServer(t)
+	server.status = http.StatusBadRequest
+	db := testDatabase(t)
+	store := testStore("")
+	store.Sink = SinkConfig{Type: SinkHTTP, URL: server.URL, Timeout: defaultSinkTimeout}
+	config := Config{Stores: []StoreConfig{store}}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	quarantined, err := QuarantinedOrders(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 2 {
+		t.Fatalf("expected orders 4200 and 4201 to be quarantined, got %+v", quarantined)
+	}
+	for _, q := range quarantined {
+		if !strings.Contains(q.Reason, "400") || !strings.Contains(q.Reason, "job already exists") {
+			t.Errorf("expected the response as the reason for order %d, got %q", q.OrderID, q.Reason)
+		}
+	}
+	if failed, _ := FailedOrders(db, store.Website); slices.ContainsFunc(failed, func(f FailedOrder) bool { return f.OrderID != 4202 }) {
+		t.Errorf("expected only order 4202 to be retried, got %+v", failed)
+	}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.requests) != 2 {
+		t.Errorf("expected the rejected orders not to be posted again, got %d posts", len(server.requests))
+	}
+}
+
+func TestGenerateFilesCSVBatch(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.Format = FormatCSV
+	store.Batch = BatchConfig{Enabled: true}
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(store.OutputDir, "orders-caterhire-*.csv"))
+	if len(files) != 1 {
+		t.Fatalf("expected a single CSV batch file, got %v", files)
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), strings.Join(csvHeader, ",")+"\n") {
+		t.Errorf("expected a CSV header, got %s", b)
+	}
+	if _, err := os.Stat(files[0] + ".manifest"); err != nil {
+		t.Errorf("expected a manifest: %v", err)
+	}
+}
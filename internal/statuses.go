@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// allStatuses in a store's statuses selects every status the store has, less
+// its exclude_statuses.
+const allStatuses = "*"
+
+// matchStatus reports whether ref, a status name or ID from the config, refers
+// to s. Names are matched against both the system name and the store's own
+// label for the status, ignoring case.
+func matchStatus(s bigcommerce.OrderStatus, ref string) bool {
+	if id, err := strconv.Atoi(ref); err == nil {
+		return s.ID == id
+	}
+	return strings.EqualFold(s.Name, ref) || strings.EqualFold(s.CustomLabel, ref)
+}
+
+// resolveStatuses finds the IDs of the statuses refs refer to. It is an error
+// for a ref to match none of the store's statuses.
+func resolveStatuses(statuses []bigcommerce.OrderStatus, refs []string) ([]int, error) {
+	var statusIDs []int
+	for _, ref := range refs {
+		found := false
+		for _, s := range statuses {
+			if ref == allStatuses || matchStatus(s, ref) {
+				found = true
+				if !slices.Contains(statusIDs, s.ID) {
+					statusIDs = append(statusIDs, s.ID)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no order status %q", ref)
+		}
+	}
+	return statusIDs, nil
+}
+
+// resolvedStatuses are a store's status IDs, as found by CheckStatuses.
+type resolvedStatuses struct {
+	export []int
+	cancel []int
+}
+
+// exportStatusIDs resolves the store's statuses, less its exclude_statuses, to
+// IDs.
+func exportStatusIDs(source OrderSource, store StoreConfig) ([]int, error) {
+	if store.statuses != nil {
+		return store.statuses.export, nil
+	}
+	statuses, err := source.GetOrderStatuses()
+	if err != nil {
+		return nil, fmt.Errorf("[ERROR] getting order statuses: %v", err)
+	}
+
+	statusIDs, err := resolveStatuses(statuses, store.Statuses)
+	if err != nil {
+		return nil, fmt.Errorf("statuses: %w", err)
+	}
+	excluded, err := resolveStatuses(statuses, store.ExcludeStatuses)
+	if err != nil {
+		return nil, fmt.Errorf("exclude_statuses: %w", err)
+	}
+	statusIDs = slices.DeleteFunc(statusIDs, func(id int) bool { return slices.Contains(excluded, id) })
+	if len(statusIDs) == 0 {
+		return nil, fmt.Errorf("every status is excluded, so no orders would be exported")
+	}
+	return statusIDs, nil
+}
+
+// resolveWriteBack resolves the store's write_back status to the ID orders
+// are moved to, so it is looked up once a run rather than for every order.
+func resolveWriteBack(source OrderSource, store StoreConfig) (StoreConfig, error) {
+	if store.WriteBack.Status == "" || store.WriteBack.statusID != nil {
+		return store, nil
+	}
+	statuses, err := source.GetOrderStatuses()
+	if err != nil {
+		return store, fmt.Errorf("[ERROR] getting order statuses: %v", err)
+	}
+
+	statusIDs, err := resolveStatuses(statuses, []string{store.WriteBack.Status})
+	if err != nil {
+		return store, fmt.Errorf("write_back status: %w", err)
+	}
+	if len(statusIDs) != 1 {
+		return store, fmt.Errorf("write_back status must be a single status, got %q", store.WriteBack.Status)
+	}
+	store.WriteBack.statusID = &statusIDs[0]
+	return store, nil
+}
+
+// CheckStatuses confirms that the statuses configured for every store exist,
+// so a typo stops start up rather than exporting the wrong orders. The config
+// it returns has them resolved, so they are not looked up again.
+func CheckStatuses(config Config) (Config, error) {
+	stores := make([]StoreConfig, len(config.Stores))
+	for i, store := range config.Stores {
+		source := NewOrderSource(store)
+		exportIDs, err := exportStatusIDs(source, store)
+		if err != nil {
+			return config, fmt.Errorf("store %s: %w", store.Website, err)
+		}
+		cancelIDs, err := cancelStatusIDs(source, store)
+		if err != nil {
+			return config, fmt.Errorf("store %s: %w", store.Website, err)
+		}
+		if store, err = resolveWriteBack(source, store); err != nil {
+			return config, fmt.Errorf("store %s: %w", store.Website, err)
+		}
+		store.statuses = &resolvedStatuses{export: exportIDs, cancel: cancelIDs}
+		stores[i] = store
+	}
+	config.Stores = stores
+	return config, nil
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+func TestResolveStatuses(t *testing.T) {
+	b, err := os.ReadFile(filepath.Join("testdata", "bigcommerce", "order_statuses.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []bigcommerce.OrderStatus
+	if err := json.Unmarshal(b, &statuses); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		refs []string
+		want []int
+	}{
+		{[]string{"Awaiting Fulfillment"}, []int{11}},
+		{[]string{"awaiting shipment", "11"}, []int{9, 11}},
+		{[]string{"11", "Awaiting Fulfillment"}, []int{11}},
+		{[]string{"*"}, []int{0, 1, 2, 5, 9, 11}},
+	}
+	for _, tt := range tests {
+		got, err := resolveStatuses(statuses, tt.refs)
+		if err != nil {
+			t.Errorf("%v: %v", tt.refs, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: expected %v, got %v", tt.refs, tt.want, got)
+		}
+	}
+
+	for _, refs := range [][]string{{"Awaiting Pickup"}, {"Awaiting Fulfillment", "42"}} {
+		if _, err := resolveStatuses(statuses, refs); err == nil {
+			t.Errorf("%v: expected an unknown status error", refs)
+		}
+	}
+}
+
+func TestExportStatusExclusions(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	source := newBigCommerceSource(bigcommerce.NewClient(fakeStoreHash, fakeAuthToken, nil, nil))
+	store := testStore(t.TempDir())
+
+	store.Statuses = []string{"*"}
+	store.ExcludeStatuses = []string{"Incomplete", "5", "Shipped"}
+	got, err := exportStatusIDs(source, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 9, 11}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	store.Statuses = []string{"Pending"}
+	store.ExcludeStatuses = []string{"Pending"}
+	if _, err := exportStatusIDs(source, store); err == nil {
+		t.Error("expected an error when every status is excluded")
+	}
+}
+
+func TestUnknownStatusFailsRun(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.Statuses = []string{"Awaiting Pickup"}
+	config := Config{Stores: []StoreConfig{store}}
+
+	_, err := CheckStatuses(config)
+	if err == nil || !strings.Contains(err.Error(), `"Awaiting Pickup"`) {
+		t.Errorf("expected CheckStatuses to name the unknown status, got %v", err)
+	}
+
+	if err := GenerateFiles(db, config, GenerateOptions{}); err == nil {
+		t.Error("expected the run to fail rather than fall back to another status")
+	}
+	if files, _ := filepath.Glob(filepath.Join(store.OutputDir, "*.xml")); len(files) != 0 {
+		t.Errorf("expected no files, got %v", files)
+	}
+}
+
+func TestCheckStatusesResolvesOnce(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.WriteBack = WriteBackConfig{Status: "Awaiting Shipment"}
+
+	config, err := CheckStatuses(Config{Stores: []StoreConfig{store}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = config.Stores[0]
+	lookups := fake.requestCount("/order_statuses")
+	if lookups == 0 {
+		t.Fatal("expected CheckStatuses to look the statuses up")
+	}
+
+	if err := GenerateFile(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+	if action, err := SyncOrderChange(db, store, 4200); err != nil || action != ActionNone {
+		t.Fatalf("expected no change, got %q, %v", action, err)
+	}
+	if err := GenerateFile(db, store, 4203); !errors.Is(err, ErrOrderNotReady) {
+		t.Errorf("expected order 4203 not to be ready, got %v", err)
+	}
+	if n := fake.requestCount("/order_statuses"); n != lookups {
+		t.Errorf("expected the resolved statuses to be used, got %d more lookups", n-lookups)
+	}
+}
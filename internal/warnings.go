@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// WarningCode identifies something about a converted order that staff should
+// look at before it is relied on, without it being invalid outright.
+type WarningCode string
+
+const (
+	WarningMissingDates             WarningCode = "missing_dates"
+	WarningCollectionBeforeDelivery WarningCode = "collection_before_delivery"
+	WarningNoLineItems              WarningCode = "no_line_items"
+	WarningMissingDeliveryAddress   WarningCode = "missing_delivery_address"
+)
+
+// Warning is one problem found while converting an order.
+type Warning struct {
+	Code    WarningCode `json:"code"`
+	Message string      `json:"message"`
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Code, w.Message)
+}
+
+// WarningPolicy is what a store does with orders that convert with warnings.
+type WarningPolicy string
+
+const (
+	// WarningPolicyEmit writes the file anyway and logs the warnings.
+	WarningPolicyEmit WarningPolicy = "emit"
+	// WarningPolicyBlock fails the attempt so the order is retried on the
+	// next run, e.g. once dates have been set with admin dates.
+	WarningPolicyBlock WarningPolicy = "block"
+	// WarningPolicyQuarantine holds the order for review until it is
+	// released with admin quarantine.
+	WarningPolicyQuarantine WarningPolicy = "quarantine"
+)
+
+const defaultWarningPolicy = WarningPolicyEmit
+
+// ErrQuarantined is returned for an order held back for review.
+var ErrQuarantined = errors.New("quarantined for review")
+
+// warnings lists the problems with a converted order.
+func (o Order) warnings() []Warning {
+	var warnings []Warning
+
+	if o.DeliveryDate == "" || o.CollectionDate == "" {
+		warnings = append(warnings, Warning{WarningMissingDates, "no delivery or collection date was found"})
+	} else {
+		delivery, derr := time.Parse(hireDateLayout, o.DeliveryDate)
+		collection, cerr := time.Parse(hireDateLayout, o.CollectionDate)
+		if derr == nil && cerr == nil && collection.Before(delivery) {
+			warnings = append(warnings, Warning{WarningCollectionBeforeDelivery, fmt.Sprintf("collection %s is before delivery %s", o.CollectionDate, o.DeliveryDate)})
+		}
+	}
+
+	if len(o.OrderLineItems.Items) == 0 {
+		warnings = append(warnings, Warning{WarningNoLineItems, "the order has no products"})
+	}
+
+	if o.DeliveryType == DELIVERY && strings.TrimSpace(o.DeliveryStreet1) == "" {
+		warnings = append(warnings, Warning{WarningMissingDeliveryAddress, "the order is for delivery but has no delivery street"})
+	}
+
+	return warnings
+}
+
+func joinWarnings(warnings []Warning) string {
+	s := make([]string, len(warnings))
+	for i, w := range warnings {
+		s[i] = w.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+// applyWarningPolicy decides whether an order with warnings can be written.
+// It returns nil if it can and an AttemptError if it is blocked or has been
+// quarantined.
+func applyWarningPolicy(db *sql.DB, store StoreConfig, data OrderBundle, warnings []Warning) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	orderID := data.Order.ID
+
+	switch store.WarningPolicy {
+	case WarningPolicyBlock:
+		return attemptError(OutcomeBlocked, "order %d has warnings: %s", orderID, joinWarnings(warnings))
+
+	case WarningPolicyQuarantine:
+		released, err := quarantineReleased(db, store.Website, orderID)
+		if err != nil {
+			return err
+		}
+		if released {
+			log.Printf("[WARNING] exporting released order %d despite warnings: %s", orderID, joinWarnings(warnings))
+			return nil
+		}
+		if err := QuarantineOrder(db, store.Website, data, joinWarnings(warnings), warnings); err != nil {
+			return err
+		}
+		return attemptError(OutcomeQuarantined, "order %d %w: %s", orderID, ErrQuarantined, joinWarnings(warnings))
+	}
+
+	log.Printf("[WARNING] order %d has warnings: %s", orderID, joinWarnings(warnings))
+	return nil
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOrderWarnings(t *testing.T) {
+	order := Order{
+		DeliveryType:    DELIVERY,
+		DeliveryStreet1: "1 Main Street",
+		DeliveryDate:    "09-12-2024",
+		CollectionDate:  "06-12-2024",
+		OrderLineItems:  OrderLineItems{Items: []OrderLineItem{{ID: "1"}}},
+	}
+
+	warnings := order.warnings()
+	if len(warnings) != 1 || warnings[0].Code != WarningCollectionBeforeDelivery {
+		t.Errorf("expected a %s warning, got %v", WarningCollectionBeforeDelivery, warnings)
+	}
+
+	order.DeliveryDate, order.CollectionDate = "", ""
+	order.DeliveryStreet1 = ""
+	order.OrderLineItems.Items = nil
+	var codes []WarningCode
+	for _, w := range order.warnings() {
+		codes = append(codes, w.Code)
+	}
+	want := []WarningCode{WarningMissingDates, WarningNoLineItems, WarningMissingDeliveryAddress}
+	if len(codes) != len(want) {
+		t.Fatalf("got warnings %v, want %v", codes, want)
+	}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("got warnings %v, want %v", codes, want)
+		}
+	}
+
+	order.DeliveryType = COLLECTION
+	order.DeliveryDate, order.CollectionDate = "06-12-2024", "09-12-2024"
+	order.OrderLineItems.Items = []OrderLineItem{{ID: "1"}}
+	if warnings := order.warnings(); len(warnings) != 0 {
+		t.Errorf("expected no warnings for a collection, got %v", warnings)
+	}
+}
+
+// undatedStore has no date sources that can find dates for the fixture
+// orders, so every order converts with a missing_dates warning.
+func undatedStore(outputDir string, policy WarningPolicy) StoreConfig {
+	store := testStore(outputDir)
+	store.DateSources = []DateSourceConfig{{Type: "override"}}
+	store.WarningPolicy = policy
+	return store
+}
+
+func TestWarningPolicyQuarantine(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := undatedStore(t.TempDir(), WarningPolicyQuarantine)
+
+	err := GenerateFile(db, store, 4200)
+	if !errors.Is(err, ErrQuarantined) {
+		t.Fatalf("expected order 4200 to be quarantined, got %v", err)
+	}
+	if _, err := os.Stat(orderFileName(store, 4200)); !os.IsNotExist(err) {
+		t.Errorf("expected no file for a quarantined order, got %v", err)
+	}
+
+	quarantined, err := QuarantinedOrders(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 1 || quarantined[0].OrderID != 4200 || quarantined[0].Warnings[0].Code != WarningMissingDates {
+		t.Fatalf("expected order 4200 in quarantine with missing dates, got %+v", quarantined)
+	}
+
+	// quarantined orders are not retried until they are released
+	failed, err := FailedOrders(db, store.Website)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 0 {
+		t.Errorf("expected quarantined orders not to be retried, got %+v", failed)
+	}
+
+	if err := ReleaseOrder(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReleaseOrder(db, store, 4200); err == nil {
+		t.Error("expected an error releasing an order twice")
+	}
+
+	if exported, _ := orderExported(db, 4200, store.Website); !exported {
+		t.Error("expected the released order to be exported")
+	}
+	if quarantined, _ := QuarantinedOrders(db, store.Website); len(quarantined) != 0 {
+		t.Errorf("expected exported orders to leave the review queue, got %+v", quarantined)
+	}
+}
+
+func TestWarningPolicyBlock(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := undatedStore(t.TempDir(), WarningPolicyBlock)
+
+	err := GenerateFile(db, store, 4200)
+	if outcomeOf(err) != OutcomeBlocked {
+		t.Fatalf("expected order 4200 to be blocked, got %v", err)
+	}
+
+	// setting the dates by hand lets it through on the next attempt
+	if err := SetHireDateOverride(db, store.Website, 4200, "06-12-2024", "09-12-2024", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateFile(db, store, 4200); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/seanomeara96/go-bigcommerce"
+)
+
+// WriteBackConfig is what is changed on an order in BigCommerce once its file
+// has been written, so staff can see it has gone to the hire system. Every
+// step is optional.
+type WriteBackConfig struct {
+	// Status is the status to move the order to, by name or ID, e.g.
+	// "Awaiting Shipment".
+	Status string `yaml:"status"`
+	// statusID is what Status resolves to, set by resolveWriteBack at the
+	// start of a run.
+	statusID *int
+	// StaffNote adds a line with the export time and file name to the
+	// order's staff notes.
+	StaffNote bool `yaml:"staff_note"`
+	// Metafield, if set, is an order metafield to record the export in.
+	Metafield *MetafieldConfig `yaml:"metafield"`
+}
+
+type MetafieldConfig struct {
+	Namespace string `yaml:"namespace"`
+	Key       string `yaml:"key"`
+}
+
+func (c WriteBackConfig) enabled() bool {
+	return c.Status != "" || c.StaffNote || c.Metafield != nil
+}
+
+func (c WriteBackConfig) validate() error {
+	if c.Metafield != nil && (c.Metafield.Namespace == "" || c.Metafield.Key == "") {
+		return fmt.Errorf("write_back metafield needs a namespace and key")
+	}
+	return nil
+}
+
+// exportRecord is the value of the write back metafield.
+type exportRecord struct {
+	File       string    `json:"file"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// writeBack updates an exported order in BigCommerce as the store is
+// configured to. The file has already been written by the time this runs, so
+// failures are for the caller to log rather than to fail the export.
+func writeBack(source OrderSource, store StoreConfig, order bigcommerce.Order, fileName string, exportedAt time.Time) error {
+	config := store.WriteBack
+	if !config.enabled() {
+		return nil
+	}
+
+	var update OrderUpdate
+	if config.Status != "" {
+		if config.statusID == nil {
+			return fmt.Errorf("write_back status %q has not been resolved", config.Status)
+		}
+		update.StatusID = config.statusID
+	}
+	if config.StaffNote {
+		note := fmt.Sprintf("Exported to the hire system as %s at %s", filepath.Base(fileName), exportedAt.UTC().Format(time.RFC3339))
+		notes := strings.TrimSpace(order.StaffNotes + "\n" + note)
+		update.StaffNotes = &notes
+	}
+	if update != (OrderUpdate{}) {
+		if err := source.UpdateOrder(order.ID, update); err != nil {
+			return err
+		}
+	}
+
+	if config.Metafield != nil {
+		value, err := json.Marshal(exportRecord{File: filepath.Base(fileName), ExportedAt: exportedAt.UTC()})
+		if err != nil {
+			return err
+		}
+		metafield := OrderMetafield{Namespace: config.Metafield.Namespace, Key: config.Metafield.Key, Value: string(value), PermissionSet: "app_only"}
+		if err := source.SetOrderMetafield(order.ID, metafield); err != nil {
+			return err
+		}
+	}
+	return nil
+}
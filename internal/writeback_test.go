@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteBack(t *testing.T) {
+	fake := newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.WriteBack = WriteBackConfig{
+		Status:    "awaiting shipment",
+		StaffNote: true,
+		Metafield: &MetafieldConfig{Namespace: "hire", Key: "export"},
+	}
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{OrderIDs: []int{4200}}); err != nil {
+		t.Fatal(err)
+	}
+
+	order := fake.order(4200)
+	if order.StatusID != 9 {
+		t.Errorf("expected order 4200 to be moved to Awaiting Shipment, got status %d", order.StatusID)
+	}
+	if !strings.Contains(order.StaffNotes, "Exported to the hire system as order4200.xml at ") {
+		t.Errorf("expected a staff note about the export, got %q", order.StaffNotes)
+	}
+
+	metafields := fake.orderMetafields(4200)
+	if len(metafields) != 1 || metafields[0].Namespace != "hire" || metafields[0].Key != "export" {
+		t.Fatalf("expected a hire.export metafield, got %+v", metafields)
+	}
+	var record exportRecord
+	if err := json.Unmarshal([]byte(metafields[0].Value), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.File != "order4200.xml" || record.ExportedAt.IsZero() {
+		t.Errorf("unexpected metafield value %s", metafields[0].Value)
+	}
+
+	// regenerating the file updates the metafield rather than adding another
+	fake.setOrderStatus(4200, 11)
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, GenerateOptions{OrderIDs: []int{4200}, Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if metafields := fake.orderMetafields(4200); len(metafields) != 1 {
+		t.Errorf("expected the metafield to be updated in place, got %+v", metafields)
+	}
+	if notes := fake.order(4200).StaffNotes; strings.Count(notes, "Exported to the hire system") != 2 {
+		t.Errorf("expected a second staff note, got %q", notes)
+	}
+}
+
+// refusingWriteBack is a source whose orders cannot be updated.
+type refusingWriteBack struct {
+	*MemoryOrderSource
+}
+
+func (refusingWriteBack) UpdateOrder(orderID int, _ OrderUpdate) error {
+	return fmt.Errorf("error updating order %d: refused", orderID)
+}
+
+func TestWriteBackFailureKeepsExport(t *testing.T) {
+	db := testDatabase(t)
+	store := testStore(t.TempDir())
+	store.WriteBack = WriteBackConfig{StaffNote: true}
+	source := refusingWriteBack{memorySource(t)}
+	opts := GenerateOptions{OrderIDs: []int{4200}, Source: func(StoreConfig) OrderSource { return source }}
+
+	if err := GenerateFiles(db, Config{Stores: []StoreConfig{store}}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if exported, _ := orderExported(db, 4200, store.Website); !exported {
+		t.Error("expected the order to stay exported when the write back fails")
+	}
+}
+
+func TestUnknownWriteBackStatus(t *testing.T) {
+	newFakeBigCommerce(t, filepath.Join("testdata", "bigcommerce"))
+	store := testStore(t.TempDir())
+
+	store.WriteBack = WriteBackConfig{Status: "No Such Status"}
+	if _, err := CheckStatuses(Config{Stores: []StoreConfig{store}}); err == nil || !strings.Contains(err.Error(), `"No Such Status"`) {
+		t.Errorf("expected CheckStatuses to name the unknown write_back status, got %v", err)
+	}
+
+	store.WriteBack = WriteBackConfig{Status: "*"}
+	if _, err := CheckStatuses(Config{Stores: []StoreConfig{store}}); err == nil {
+		t.Error("expected a write_back status matching every status to be refused")
+	}
+}